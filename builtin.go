@@ -0,0 +1,80 @@
+package seed
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// redirectCtxKey 内置重定向处理器的目标在 context.Context 中的 Key
+var redirectCtxKey = &ContextKey{Name: "Redirect"}
+
+// matchErrorCtxKey Matcher 拒绝请求时的 *MatchError 在 context.Context 中的 Key
+var matchErrorCtxKey = &ContextKey{Name: "MatchError"}
+
+// builtinHandlers 路由器内置的 404、405、OPTIONS、重定向及 Matcher 拒绝请求时的处理器，已合并路由器的中间件
+//
+// 首次使用时组装中间件链，Use 添加中间件后重新组装，请求时不再组装
+type builtinHandlers struct {
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+	options          http.Handler
+	redirect         http.Handler
+	matchError       http.Handler
+}
+
+// redirectTarget 重定向的目标地址及状态码
+type redirectTarget struct {
+	url  string
+	code int
+}
+
+// builtins 返回当前中间件下的内置处理器
+func (r *router) builtins() *builtinHandlers {
+	if b := r.builtin.Load(); b != nil {
+		return b
+	}
+	var b = &builtinHandlers{
+		notFound:         r.TransHandler(globalHandler(&NotFoundHandler)),
+		methodNotAllowed: r.TransHandler(globalHandler(&MethodNotAllowedHandler)),
+		options:          r.TransHandler(globalHandler(&OptionsHandler)),
+		redirect:         r.TransHandler(http.HandlerFunc(serveRedirect)),
+		matchError:       r.TransHandler(serveMatchError.Handler()),
+	}
+	r.builtin.Store(b)
+	return b
+}
+
+// newBuiltin 返回尚未组装的内置处理器
+func newBuiltin() *atomic.Pointer[builtinHandlers] {
+	return new(atomic.Pointer[builtinHandlers])
+}
+
+// globalHandler 每次请求时读取 *h，修改 NotFoundHandler 等全局处理器后仍然生效
+func globalHandler(h *HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		(*h).Handler().ServeHTTP(w, req)
+	})
+}
+
+// withRedirect 将重定向的目标保存到 context 中，由内置的重定向处理器读取
+func withRedirect(req *http.Request, target redirectTarget) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), redirectCtxKey, target))
+}
+
+// serveRedirect 重定向到 context 中保存的目标
+func serveRedirect(w http.ResponseWriter, req *http.Request) {
+	var target, _ = req.Context().Value(redirectCtxKey).(redirectTarget)
+	http.Redirect(w, req, target.url, target.code)
+}
+
+// withMatchError 将 Matcher 给出的错误保存到 context 中，由内置的处理器读取
+func withMatchError(req *http.Request, err *MatchError) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), matchErrorCtxKey, err))
+}
+
+// serveMatchError 以 Matcher 给出的状态码响应
+var serveMatchError HandlerFunc = func(ctx context.Context, req Request) Response {
+	var err, _ = ctx.Value(matchErrorCtxKey).(*MatchError)
+	return NopResponse(err.Status)
+}
@@ -0,0 +1,255 @@
+package seed
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 路由段的类型，值越大越优先匹配
+const (
+	segmentCatchAll = iota
+	segmentParam
+	segmentConstraint
+	segmentLiteral
+)
+
+// patternSegment 路由 pattern 中的一段
+type patternSegment struct {
+	kind       int
+	literal    string
+	constraint string
+	regexp     *regexp.Regexp
+}
+
+// parsePattern 对路由 pattern 分段，使用 WithStrictSlash 时末尾的 / 会产生一个空的字面量段
+func parsePattern(pattern string, strictSlash bool) []patternSegment {
+	var trailingSlash = strictSlash && len(pattern) > 1 && strings.HasSuffix(pattern, "/")
+	pattern = rexp.ReplaceAllString(strings.Trim(pattern, "/"), "/")
+	var segments []patternSegment
+	if pattern != "" && pattern != "/" {
+		for _, s := range strings.Split(pattern, "/") {
+			segments = append(segments, newPatternSegment(s))
+		}
+	}
+	if trailingSlash {
+		segments = append(segments, patternSegment{kind: segmentLiteral})
+	}
+	return segments
+}
+
+// newPatternSegment 解析单个路由段
+func newPatternSegment(s string) patternSegment {
+	if _, isCatchAll := catchAllName(s); isCatchAll {
+		return patternSegment{kind: segmentCatchAll}
+	}
+	var _, constraint, isParam = paramName(s)
+	switch {
+	case !isParam:
+		return patternSegment{kind: segmentLiteral, literal: s}
+	case constraint == "":
+		return patternSegment{kind: segmentParam}
+	}
+	var exp, _ = compileConstraint(constraint)
+	return patternSegment{kind: segmentConstraint, constraint: constraint, regexp: exp}
+}
+
+// overlap 判断两个非末尾通配的路由段是否一定能匹配同一个值
+//
+// 约束不同的两个参数段无法判断，按不重叠处理
+func (s patternSegment) overlap(o patternSegment, caseSensitive bool) bool {
+	if s.kind < o.kind {
+		s, o = o, s
+	}
+	switch {
+	case s.kind == segmentLiteral && o.kind == segmentLiteral:
+		return s.literal == o.literal || !caseSensitive && strings.EqualFold(s.literal, o.literal)
+	case s.kind == segmentLiteral && o.kind == segmentConstraint:
+		return s.literal != "" && o.regexp != nil && o.regexp.MatchString(s.literal)
+	case s.kind == segmentLiteral:
+		return s.literal != ""
+	case s.kind == segmentConstraint && o.kind == segmentConstraint:
+		return s.constraint == o.constraint
+	}
+	return true
+}
+
+// ambiguous 判断两个路由 pattern 是否有歧义
+//
+// 两个 pattern 能匹配同一个 path，且各有更优先的段时有歧义，如 /a/*/c 与 /a/b/*
+// 一个 pattern 的每一段都不低于另一个时，按匹配优先级总能选出前者，不算歧义
+func ambiguous(a, b []patternSegment, caseSensitive bool) bool {
+	var aFirst, bFirst = false, false
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i == len(a):
+			// 末尾通配可以匹配空的剩余路径
+			return b[i].kind == segmentCatchAll && bFirst
+		case i == len(b):
+			return a[i].kind == segmentCatchAll && aFirst
+		case a[i].kind == segmentCatchAll && b[i].kind == segmentCatchAll:
+			return aFirst && bFirst
+		case a[i].kind == segmentCatchAll:
+			return aFirst
+		case b[i].kind == segmentCatchAll:
+			return bFirst
+		case !a[i].overlap(b[i], caseSensitive):
+			return false
+		}
+		aFirst = aFirst || a[i].kind > b[i].kind
+		bFirst = bFirst || a[i].kind < b[i].kind
+	}
+	return aFirst && bFirst
+}
+
+// routeOverlapper 可以只返回可能与路由重叠的路由的 RouteMapper，用于避免每次注册都遍历全部路由
+type routeOverlapper interface {
+	overlapping(r *route) []Route
+}
+
+// checkAmbiguous 检查 r 与路由表中同一方法、同一 host 的路由是否有歧义，带 Matcher 的路由不检查
+func (t *routeTable) checkAmbiguous(r *route, caseSensitive bool) error {
+	if len(r.matchers) > 0 {
+		return nil
+	}
+	var candidates []Route
+	if o, ok := t.mapper.(routeOverlapper); ok {
+		candidates = o.overlapping(r)
+	} else {
+		candidates = t.mapper.Routes()
+	}
+	for _, rt := range candidates {
+		var other, ok = rt.(*route)
+		if !ok || other.method != r.method || len(other.matchers) > 0 || !strings.EqualFold(other.host, r.host) {
+			continue
+		}
+		if ambiguous(r.segments, other.segments, caseSensitive) {
+			return fmt.Errorf("ambiguous route method: %s path: %s overlaps path: %s ", r.method, r.path, other.path)
+		}
+	}
+	return nil
+}
+
+// overlapWalk 在路由树中查找可能与某个路由 pattern 重叠的路由
+//
+// 只进入各分段都可能重叠的分支，结果是有歧义的路由的超集，最终由 ambiguous 判断
+type overlapWalk struct {
+	segments []patternSegment
+
+	// literals 字面量分段在路由树中的形式
+	literals []string
+	routes   []Route
+}
+
+// overlapState 遍历到路由树某个位置时的状态
+type overlapState struct {
+	// i 已经完整经过的分段数
+	i int
+
+	// pos 当前分段是字面量时已经匹配的字节数
+	pos int
+
+	// param 当前分段是路由树中的参数
+	param bool
+}
+
+// overlapping 实现 routeOverlapper
+func (rm *radixMapper) overlapping(r *route) []Route {
+	var roots = rm.roots
+	if r.host != "" {
+		var rh, _ = rm.hostFor(r.host, false)
+		if rh == nil {
+			return nil
+		}
+		roots = rh.roots
+	}
+	var root = roots[r.method]
+	if root == nil {
+		return nil
+	}
+	var w = &overlapWalk{segments: r.segments, literals: make([]string, len(r.segments))}
+	for i, segment := range r.segments {
+		if segment.kind == segmentLiteral {
+			w.literals[i] = rm.literal(segment.literal)
+		}
+	}
+	w.visit(root, overlapState{})
+	return w.routes
+}
+
+// visit 收集节点 n 及其可能重叠的子节点上的路由，st 是经过 n.prefix 之后的状态
+func (w *overlapWalk) visit(n *radixNode, st overlapState) {
+	if w.catchAll(st) {
+		w.all(n)
+		return
+	}
+	for _, leaf := range n.leaves {
+		w.routes = append(w.routes, leaf.route)
+	}
+	for _, child := range n.statics {
+		if next, ok := w.consume(child.prefix, st); ok {
+			w.visit(child, next)
+		}
+	}
+	if st.i < len(w.segments) {
+		for _, child := range n.constraints {
+			w.visit(child, overlapState{i: st.i, param: true})
+		}
+		if n.param != nil {
+			w.visit(n.param, overlapState{i: st.i, param: true})
+		}
+	}
+	if n.catchAll != nil {
+		w.all(n.catchAll)
+	}
+}
+
+// consume 经过静态片段 prefix，不可能重叠时返回 false
+func (w *overlapWalk) consume(prefix string, st overlapState) (overlapState, bool) {
+	for j := 0; j < len(prefix); j++ {
+		if w.catchAll(st) {
+			return st, true
+		}
+		if prefix[j] == '/' {
+			if !st.param && st.i < len(w.segments) && w.segments[st.i].kind == segmentLiteral && st.pos != len(w.literals[st.i]) {
+				return st, false
+			}
+			st = overlapState{i: st.i + 1}
+			continue
+		}
+		if st.i >= len(w.segments) {
+			return st, false
+		}
+		if w.segments[st.i].kind == segmentLiteral {
+			if st.pos >= len(w.literals[st.i]) || w.literals[st.i][st.pos] != prefix[j] {
+				return st, false
+			}
+			st.pos++
+		}
+	}
+	return st, true
+}
+
+// catchAll 判断 pattern 在当前分段的开头是末尾通配，此后的路由都可能重叠
+func (w *overlapWalk) catchAll(st overlapState) bool {
+	return st.i < len(w.segments) && st.pos == 0 && !st.param && w.segments[st.i].kind == segmentCatchAll
+}
+
+// all 收集节点 n 及其全部子节点上的路由
+func (w *overlapWalk) all(n *radixNode) {
+	for _, leaf := range n.leaves {
+		w.routes = append(w.routes, leaf.route)
+	}
+	for _, child := range n.statics {
+		w.all(child)
+	}
+	for _, child := range n.constraints {
+		w.all(child)
+	}
+	if n.param != nil {
+		w.all(n.param)
+	}
+	if n.catchAll != nil {
+		w.all(n.catchAll)
+	}
+}
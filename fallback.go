@@ -0,0 +1,161 @@
+package seed
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// fallback 路由器或分组设置的 404、405 处理器，发布到路由表后不再修改
+type fallback struct {
+	key      string
+	host     *hostPattern
+	prefix   []string
+	notFound http.Handler
+
+	// rawNotFound 未合并中间件的 404 处理器，用于已经过中间件的请求，如静态文件不存在
+	rawNotFound http.Handler
+
+	methodNotAllowed http.Handler
+
+	// options 自动响应 OPTIONS 的处理器，已合并分组的中间件
+	options http.Handler
+}
+
+// NotFound 实现 Router
+func (r *router) NotFound(handlerFunc HandlerFunc) Router {
+	var raw = handlerFunc.Handler()
+	var h = r.TransHandler(raw)
+	r.setFallback(func(fb *fallback) { fb.notFound, fb.rawNotFound = h, raw })
+	return r
+}
+
+// MethodNotAllowed 实现 Router
+func (r *router) MethodNotAllowed(handlerFunc HandlerFunc) Router {
+	var h = r.TransHandler(handlerFunc.Handler())
+	r.setFallback(func(fb *fallback) { fb.methodNotAllowed = h })
+	return r
+}
+
+// setOptions 分组比 parent 多了中间件时，自动响应的 OPTIONS 请求也经过这些中间件，如分组的 CORS 中间件
+//
+//	在分组的 f 执行之后调用，前缀及 host 相同的分组以最后一个为准
+func (r *router) setOptions(parent *router) {
+	if len(r.middlewareFuncs) == len(parent.middlewareFuncs) {
+		return
+	}
+	var h = r.TransHandler(globalHandler(&OptionsHandler))
+	r.setFallback(func(fb *fallback) { fb.options = h })
+}
+
+// setFallback 修改当前 host 及 prefix 对应的 fallback，与路由一起原子替换
+func (r *router) setFallback(set func(fb *fallback)) {
+	var fb = r.newFallback()
+	_ = r.tables.update(func(t *routeTable) error {
+		t.setFallback(fb, set)
+		return nil
+	})
+}
+
+// newFallback 返回当前 host 及 prefix 对应的空 fallback
+func (r *router) newFallback() *fallback {
+	var fb = &fallback{key: r.host + " " + r.prefix, prefix: splitPath(r.prefix)}
+	if r.host != "" {
+		var hp, err = newHostPattern(r.host)
+		if err != nil {
+			panic(err.Error())
+		}
+		fb.host = hp
+	}
+	if !r.options.caseSensitive {
+		for i, segment := range fb.prefix {
+			fb.prefix[i] = strings.ToLower(segment)
+		}
+	}
+	return fb
+}
+
+// setFallback 复制 key 相同的 fallback 后修改，不存在时插入 fb
+//
+// fallbacks 按匹配顺序排列: 前缀越长越靠前，长度相同时字面量分段靠前，再相同时限定 host 的靠前，其余按设置顺序
+func (t *routeTable) setFallback(fb *fallback, set func(fb *fallback)) {
+	t.fallbacks = slices.Clone(t.fallbacks)
+	if i := slices.IndexFunc(t.fallbacks, func(other *fallback) bool { return other.key == fb.key }); i >= 0 {
+		var c = *t.fallbacks[i]
+		set(&c)
+		t.fallbacks[i] = &c
+		return
+	}
+	set(fb)
+	var i = slices.IndexFunc(t.fallbacks, fb.before)
+	if i < 0 {
+		i = len(t.fallbacks)
+	}
+	t.fallbacks = slices.Insert(t.fallbacks, i, fb)
+}
+
+// before 判断 fb 是否应排在 other 之前匹配
+func (fb *fallback) before(other *fallback) bool {
+	if len(fb.prefix) != len(other.prefix) {
+		return len(fb.prefix) > len(other.prefix)
+	}
+	for i, segment := range fb.prefix {
+		var _, _, isParam = paramName(segment)
+		var _, _, otherIsParam = paramName(other.prefix[i])
+		if isParam != otherIsParam {
+			return otherIsParam
+		}
+	}
+	return fb.host != nil && other.host == nil
+}
+
+// fallbackHandler 返回路由表 t 中请求所在的最内层分组设置的处理器，都没有设置时返回 nil
+func (r *router) fallbackHandler(t *routeTable, req *http.Request, reqPath string, get func(fb *fallback) http.Handler) http.Handler {
+	var segments = splitPath(reqPath)
+	for i, segment := range segments {
+		if r.options.useRawPath {
+			if v, err := url.PathUnescape(segment); err == nil {
+				segment = v
+			}
+		}
+		if !r.options.caseSensitive {
+			segment = strings.ToLower(segment)
+		}
+		segments[i] = segment
+	}
+
+	var host = requestHost(req)
+	for _, fb := range t.fallbacks {
+		if h := get(fb); h != nil && fb.match(host, segments) {
+			return h
+		}
+	}
+	return nil
+}
+
+// match 判断请求是否在分组范围内
+func (fb *fallback) match(host string, segments []string) bool {
+	if fb.host != nil {
+		if _, ok := fb.host.match(host, nil); !ok {
+			return false
+		}
+	}
+	if len(segments) < len(fb.prefix) {
+		return false
+	}
+	for i, segment := range fb.prefix {
+		if _, _, isParam := paramName(segment); isParam {
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPath 按 / 对路径分段，忽略空的分段
+func splitPath(p string) []string {
+	return strings.FieldsFunc(p, func(c rune) bool { return c == '/' })
+}
@@ -24,3 +24,13 @@ func (h HandlerFunc) Handler() http.Handler {
 var NotFoundHandler HandlerFunc = func(ctx context.Context, req Request) Response {
 	return NopResponse(http.StatusNotFound)
 }
+
+// MethodNotAllowedHandler 405默认处理器
+var MethodNotAllowedHandler HandlerFunc = func(ctx context.Context, req Request) Response {
+	return NopResponse(http.StatusMethodNotAllowed)
+}
+
+// OptionsHandler 未注册 OPTIONS 路由时的默认处理器，调用前已设置好 Allow Header
+var OptionsHandler HandlerFunc = func(ctx context.Context, req Request) Response {
+	return NopResponse(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+package seed
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter 用 GET 路由响应 HEAD 请求时丢弃响应体，保留 Header 并补全 Content-Length
+type headResponseWriter struct {
+	http.ResponseWriter
+
+	code  int
+	bytes int
+}
+
+// WriteHeader 延迟到 handler 结束后再写入，以便统计 Content-Length
+func (h *headResponseWriter) WriteHeader(code int) {
+	if h.code == 0 {
+		h.code = code
+	}
+}
+
+// Write 丢弃响应体，只统计长度
+func (h *headResponseWriter) Write(buf []byte) (int, error) {
+	h.bytes += len(buf)
+	return len(buf), nil
+}
+
+// finish 写入 Content-Length 以及状态码
+func (h *headResponseWriter) finish() {
+	if h.code == 0 {
+		h.code = http.StatusOK
+	}
+	var header = h.ResponseWriter.Header()
+	if _, has := header[HeaderContentLength]; !has && h.code >= http.StatusOK &&
+		h.code != http.StatusNoContent && h.code != http.StatusNotModified {
+		header.Set(HeaderContentLength, strconv.Itoa(h.bytes))
+	}
+	h.ResponseWriter.WriteHeader(h.code)
+}
@@ -0,0 +1,104 @@
+package seed
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// hostPattern 解析后的 host pattern
+type hostPattern struct {
+	pattern string
+	labels  []string
+	names   []string
+	regexps []*regexp.Regexp
+	params  bool
+}
+
+// newHostPattern 解析 host pattern
+//
+//	pattern 按 . 分段，每段可以是字面量，也可以是 {name}、{name:constraint}、:name 或 * 形式的参数
+func newHostPattern(pattern string) (*hostPattern, error) {
+	var hp = &hostPattern{pattern: strings.ToLower(pattern)}
+	for _, label := range strings.Split(hp.pattern, ".") {
+		var name, constraint, isParam = paramName(label)
+		var exp *regexp.Regexp
+		if isParam && constraint != "" {
+			var err error
+			if exp, err = compileConstraint(constraint); err != nil {
+				return nil, fmt.Errorf("invalid host constraint host: %s err: %v", pattern, err)
+			}
+		}
+		if isParam {
+			label, hp.params = "", true
+		}
+		hp.labels = append(hp.labels, label)
+		hp.names = append(hp.names, name)
+		hp.regexps = append(hp.regexps, exp)
+	}
+	return hp, nil
+}
+
+// match 匹配请求的 host，host 中捕获的参数追加到 ps 中返回
+func (hp *hostPattern) match(host string, ps Params) (Params, bool) {
+	var base = len(ps)
+	for i := range hp.labels {
+		var label = host
+		if i < len(hp.labels)-1 {
+			var dot = strings.IndexByte(host, '.')
+			if dot < 0 {
+				return ps[:base], false
+			}
+			label, host = host[:dot], host[dot+1:]
+		} else if strings.IndexByte(host, '.') >= 0 {
+			return ps[:base], false
+		}
+
+		switch {
+		case hp.labels[i] != "":
+			if hp.labels[i] != label {
+				return ps[:base], false
+			}
+		case label == "":
+			return ps[:base], false
+		case hp.regexps[i] != nil && !hp.regexps[i].MatchString(label):
+			return ps[:base], false
+		case hp.names[i] != "":
+			ps = append(ps, Param{Key: hp.names[i], Value: label})
+		}
+	}
+	return ps, true
+}
+
+// hostInsertIndex 返回新 host 在 n 个已有 host 中的插入位置
+//
+// 不含参数的 host 排在含参数的 host 之前，同类按注册顺序排列
+func hostInsertIndex(hp *hostPattern, n int, hasParams func(i int) bool) int {
+	if hp.params {
+		return n
+	}
+	var i = 0
+	for i < n && !hasParams(i) {
+		i++
+	}
+	return i
+}
+
+// requestHost 返回请求中去掉端口并转为小写的 host
+func requestHost(req *http.Request) string {
+	var host = req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// Host 实现 Router
+func (r *router) Host(pattern string, f func(r Router), ms ...MiddlewareFunc) {
+	var router = r.fork(ms...)
+	router.host = pattern
+	f(router)
+	router.setOptions(r)
+}
@@ -0,0 +1,152 @@
+package seed
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Matcher 路由的附加匹配条件，在 path 匹配之后判断
+//
+//	同一 path 可以注册多个带不同 Matcher 的路由，按注册顺序选择第一个满足全部 Matcher 的路由
+type Matcher interface {
+	// Match 判断请求是否满足条件
+	Match(req *http.Request) bool
+
+	// Status 没有路由满足条件时响应的状态码，如 406、415，404 表示按未匹配到路由处理
+	Status() int
+}
+
+// MatchError path 匹配但没有路由满足 Matcher 时 RouteMapper.Find 返回的错误
+type MatchError struct {
+	Status int
+}
+
+func (e *MatchError) Error() string {
+	return fmt.Sprintf("route matcher rejected with status: %d", e.Status)
+}
+
+// MatcherFunc 函数形式的 Matcher，不满足时按未匹配到路由处理
+type MatcherFunc func(req *http.Request) bool
+
+// Match 实现 Matcher
+func (f MatcherFunc) Match(req *http.Request) bool {
+	return f(req)
+}
+
+// Status 实现 Matcher
+func (f MatcherFunc) Status() int {
+	return http.StatusNotFound
+}
+
+// statusMatcher 带状态码的 Matcher
+type statusMatcher struct {
+	match  func(req *http.Request) bool
+	status int
+}
+
+func (m *statusMatcher) Match(req *http.Request) bool {
+	return m.match(req)
+}
+
+func (m *statusMatcher) Status() int {
+	return m.status
+}
+
+// HeaderMatcher 请求 Header 中 key 的值为 value 时匹配，value 为空时只要求 Header 存在
+func HeaderMatcher(key, value string) Matcher {
+	return MatcherFunc(func(req *http.Request) bool {
+		var vs = req.Header.Values(key)
+		if value == "" {
+			return len(vs) > 0
+		}
+		for _, v := range vs {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// QueryMatcher 请求的查询参数中存在 key 时匹配，给出 values 时还要求值是其中之一
+func QueryMatcher(key string, values ...string) Matcher {
+	return MatcherFunc(func(req *http.Request) bool {
+		var vs, has = req.URL.Query()[key]
+		if !has {
+			return false
+		}
+		if len(values) == 0 {
+			return true
+		}
+		for _, v := range vs {
+			for _, value := range values {
+				if v == value {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// ContentTypeMatcher 请求的 Content-Type 是 mediaTypes 之一时匹配，如 "application/json"
+//
+//	不支持 * 通配，没有路由满足时响应 415
+func ContentTypeMatcher(mediaTypes ...string) Matcher {
+	return &statusMatcher{status: http.StatusUnsupportedMediaType, match: func(req *http.Request) bool {
+		var mediaType, _, err = mime.ParseMediaType(req.Header.Get(HeaderContentType))
+		if err != nil {
+			return false
+		}
+		for _, t := range mediaTypes {
+			if strings.EqualFold(t, mediaType) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// AcceptMatcher 请求的 Accept 能接受 mediaTypes 之一时匹配，如 "application/vnd.v2+json"
+//
+//	Accept 中的 */* 与 type/* 可以匹配任意类型，没有 Accept 时视为接受任意类型，没有路由满足时响应 406
+func AcceptMatcher(mediaTypes ...string) Matcher {
+	return &statusMatcher{status: http.StatusNotAcceptable, match: func(req *http.Request) bool {
+		var accept = req.Header.Get("Accept")
+		if accept == "" {
+			return true
+		}
+		for _, part := range strings.Split(accept, ",") {
+			var accepted, params, err = mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || params["q"] == "0" {
+				continue
+			}
+			for _, t := range mediaTypes {
+				if acceptMediaType(accepted, t) {
+					return true
+				}
+			}
+		}
+		return false
+	}}
+}
+
+// acceptMediaType 判断 Accept 中的 accepted 是否能接受 mediaType
+func acceptMediaType(accepted, mediaType string) bool {
+	if accepted == "*/*" || strings.EqualFold(accepted, mediaType) {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(accepted, "/*"); ok {
+		return strings.HasPrefix(strings.ToLower(mediaType), prefix+"/")
+	}
+	return false
+}
+
+// Match 实现 Router
+func (r *router) Match(matchers ...Matcher) Router {
+	var router = r.fork()
+	router.matchers = append(append([]Matcher{}, r.matchers...), matchers...)
+	return router
+}
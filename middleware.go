@@ -3,16 +3,147 @@ package seed
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
+// SkipMetaKey 路由跳过的中间件名称在路由元数据中的 key，详见 RouteSetter.Skip
+const SkipMetaKey = "seed.middleware.skip"
+
 // MiddleWareQueue 中间件执行队列
 type MiddleWareQueue interface {
 	Next(ctx context.Context, w http.ResponseWriter, req *http.Request) bool
 }
 
 // MiddlewareFunc 中间件执行器
+//
+// ctx 与 req.Context() 是同一个 context，中间件可以修改其中任意一个后调用 next.Next：
+//
+//	next.Next(context.WithValue(ctx, k, v), w, req)
+//	next.Next(ctx, w, req.WithContext(context.WithValue(ctx, k, v)))
+//
+// 下一层及业务 handler 的 ctx 与 req.Context() 相同：只修改了其中一个时使用修改后的 context，
+// 两者都修改了时合并，按 key 取值时 ctx 优先，任意一个被取消时都会被取消
 type MiddlewareFunc func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool
 
+// When 请求满足 predicate 时才执行中间件 m
+func When(predicate func(req *http.Request) bool, m MiddlewareFunc) MiddlewareFunc {
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		if !predicate(req) {
+			return next.Next(ctx, w, req)
+		}
+		return m(ctx, w, req, next)
+	}
+}
+
+// Unless 请求路径是 pathPrefix 或在 pathPrefix 之下时跳过中间件 m，按路径分段匹配
+//
+//	如 r.Use(seed.Unless("/health", middleware.Logger)) 跳过 /health、/health/live，不跳过 /healthz
+//	匹配到路由时与路由器的匹配规则一致，默认不区分大小写，使用 WithRawPath 时分段中的 %2F 不是分隔符
+func Unless(pathPrefix string, m MiddlewareFunc) MiddlewareFunc {
+	var want = strings.Split(strings.Trim(pathPrefix, "/"), "/")
+	return When(func(req *http.Request) bool {
+		return !underPath(req, want)
+	}, m)
+}
+
+// underPath 请求路径的前几个分段是否与 want 相同，未匹配到路由时按 URL.Path 区分大小写比较
+func underPath(req *http.Request, want []string) bool {
+	if len(want) == 1 && want[0] == "" {
+		return true
+	}
+	var o = routerOptions{caseSensitive: true}
+	if r, ok := RouteFromContext(req.Context()).(*route); ok {
+		o = r.options
+	}
+	var p = strings.TrimPrefix(o.requestPath(req), "/")
+	for _, w := range want {
+		var segment string
+		segment, p, _ = strings.Cut(p, "/")
+		if o.useRawPath {
+			if unescaped, err := url.PathUnescape(segment); err == nil {
+				segment = unescaped
+			}
+		}
+		if segment != w && (o.caseSensitive || !strings.EqualFold(segment, w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Named 为中间件命名，匹配到的路由通过 RouteSetter.Skip 跳过该名称时不执行 m
+//
+//	r.Use(seed.Named("auth", auth))
+//	r.HandleFunc("GET", "/login", login).Skip("auth")
+func Named(name string, m MiddlewareFunc) MiddlewareFunc {
+	return When(func(req *http.Request) bool {
+		var route = RouteFromContext(req.Context())
+		if route == nil {
+			return true
+		}
+		var names, _ = route.Meta(SkipMetaKey)
+		var skipped, _ = names.([]string)
+		return !slices.Contains(skipped, name)
+	}, m)
+}
+
+// Skip 实现 RouteSetter
+func (rs *routeSetter) Skip(names ...string) RouteSetter {
+	for _, r := range rs.routes {
+		var old, _ = r.Meta(SkipMetaKey)
+		var skipped, _ = old.([]string)
+		r.setMeta(SkipMetaKey, append(slices.Clip(skipped), names...))
+	}
+	return rs
+}
+
+// stdNextCtxKey StdMiddleware 调用 next 所需的状态在 context.Context 中的 Key
+var stdNextCtxKey = &ContextKey{Name: "StdNext"}
+
+// StdMiddleware 将 func(http.Handler) http.Handler 形式的中间件转换为 MiddlewareFunc，可以直接用于 Router.Use
+//
+//	mw 只在转换时调用一次
+//	mw 没有调用 next 时中止执行，返回 false
+//	mw 通过 r.WithContext 修改的 context 会传递给之后的中间件及业务 handler
+func StdMiddleware(mw func(http.Handler) http.Handler) MiddlewareFunc {
+	var h = mw(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var next, _ = req.Context().Value(stdNextCtxKey).(*stdNext)
+		if next == nil {
+			return
+		}
+		next.result = next.queue.Next(req.Context(), w, req)
+	}))
+	return func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		var state = &stdNext{queue: next}
+		ctx = context.WithValue(ctx, stdNextCtxKey, state)
+		h.ServeHTTP(w, req.WithContext(ctx))
+		return state.result
+	}
+}
+
+// stdNext 一次请求中 StdMiddleware 的 next 状态
+type stdNext struct {
+	queue  MiddleWareQueue
+	result bool
+}
+
+// Std 将中间件转换为 func(http.Handler) http.Handler 形式，可以用于其他路由库
+//
+//	中间件没有调用 next.Next 时不会执行 next handler
+//	传给 next.Next 的 ctx 会合并到 next handler 的 r.Context() 中
+func (m MiddlewareFunc) Std() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		var chain = newMiddlewareChain(MiddlewareFuncs{m}, next)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			chain.Next(req.Context(), w, req)
+		})
+	}
+}
+
 // MiddlewareFuncs 中间件执行器队列示例
 type MiddlewareFuncs []MiddlewareFunc
 
@@ -21,14 +152,186 @@ type MiddlewareFuncs []MiddlewareFunc
 // 执行顺序： filter1 -> filter2 -> filter3
 // 若 filter2 返回 false，调用将终止，即 filter3 不会被执行
 func (ms MiddlewareFuncs) Next(ctx context.Context, w http.ResponseWriter, req *http.Request) bool {
-	if len(ms) <= 0 {
-		return false
-	}
-	var f = ms[0]
-	return f(ctx, w, req, ms[1:])
+	return newMiddlewareChain(ms, nil).Next(ctx, w, req)
 }
 
 // NewMiddleWareQueue 创建一个中间件执行队列
 func NewMiddleWareQueue(funcs ...MiddlewareFunc) MiddleWareQueue {
 	return MiddlewareFuncs(funcs)
 }
+
+// middlewareChain 注册时组装好的中间件链，每个节点是一个中间件，h 不为 nil 时最后一个节点执行业务 handler
+type middlewareChain struct {
+	f    MiddlewareFunc
+	next *middlewareChain
+
+	// depth 从该节点到链尾的节点数
+	depth int
+}
+
+// newMiddlewareChain 组装依次执行 ms 及 h 的中间件链，h 为 nil 时最后一个中间件的 next.Next 返回 false
+func newMiddlewareChain(ms MiddlewareFuncs, h http.Handler) *middlewareChain {
+	var chain *middlewareChain
+	if h != nil {
+		chain = &middlewareChain{f: func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			h.ServeHTTP(w, req)
+			return false
+		}, depth: 1}
+	}
+	for i := len(ms) - 1; i >= 0; i-- {
+		chain = &middlewareChain{f: ms[i], next: chain, depth: len(ms) - i}
+		if h != nil {
+			chain.depth++
+		}
+	}
+	return chain
+}
+
+// Next 实现 MiddleWareQueue，每次请求分配一次 chainCall 记录各节点收到的 context
+func (c *middlewareChain) Next(ctx context.Context, w http.ResponseWriter, req *http.Request) bool {
+	if c == nil {
+		return false
+	}
+	var calls = make([]chainCall, c.depth)
+	for i, node := 0, c; node != nil; i, node = i+1, node.next {
+		calls[i].node = node
+		if i > 0 {
+			calls[i-1].next = &calls[i]
+		}
+	}
+	ctx, req = syncContext(nil, ctx, req)
+	return calls[0].run(ctx, w, req)
+}
+
+// chainCall 一次请求中的一个中间件链节点，是传给该节点的 next
+type chainCall struct {
+	node *middlewareChain
+
+	// ctx 传给该节点的 context，next.Next 时用于判断中间件修改了 ctx 还是 req
+	ctx  context.Context
+	next *chainCall
+}
+
+// run 执行节点的中间件
+func (c *chainCall) run(ctx context.Context, w http.ResponseWriter, req *http.Request) bool {
+	c.ctx = ctx
+	return c.node.f(ctx, w, req, c)
+}
+
+// Next 实现 MiddleWareQueue
+func (c *chainCall) Next(ctx context.Context, w http.ResponseWriter, req *http.Request) bool {
+	if c.next == nil {
+		return false
+	}
+	ctx, req = syncContext(c.ctx, ctx, req)
+	return c.next.run(ctx, w, req)
+}
+
+// syncContext 使 ctx 与 req.Context() 保持一致，passed 是传给上一层的 context
+//
+// 只修改了其中一个时使用修改后的 context，两者都修改了时合并，两者相同时不分配内存
+func syncContext(passed, ctx context.Context, req *http.Request) (context.Context, *http.Request) {
+	switch {
+	case req == nil:
+		return ctx, req
+	case ctx == nil:
+		return req.Context(), req
+	case ctx == req.Context():
+		return ctx, req
+	case passed != nil && ctx == passed:
+		return req.Context(), req
+	case passed != nil && req.Context() == passed:
+		return ctx, req.WithContext(ctx)
+	}
+	ctx = mergeContext(ctx, req.Context())
+	return ctx, req.WithContext(ctx)
+}
+
+// mergedContext 合并中间件传入的 ctx 与 req.Context()
+//
+// 中间件同时修改了两者时使用，按 key 取值时先查 ctx 再查 req.Context()，任意一个结束时结束，截止时间取更早的一个
+type mergedContext struct {
+	ctx, reqCtx context.Context
+
+	// signal 只有一个 context 会结束时为该 context，否则为 nil，使用 done 和 err
+	signal context.Context
+
+	mu    sync.Mutex
+	done  chan struct{}
+	err   error
+	stops [2]func() bool
+}
+
+// mergeContext 合并 ctx 与 reqCtx，两者通常是中间件在同一个 context 上分别修改的结果
+func mergeContext(ctx, reqCtx context.Context) context.Context {
+	var c = &mergedContext{ctx: ctx, reqCtx: reqCtx}
+	switch {
+	case ctx.Err() != nil:
+		c.signal = ctx
+	case reqCtx.Err() != nil:
+		c.signal = reqCtx
+	case reqCtx.Done() == nil || reqCtx.Done() == ctx.Done():
+		c.signal = ctx
+	case ctx.Done() == nil:
+		c.signal = reqCtx
+	default:
+		c.done = make(chan struct{})
+		c.mu.Lock()
+		c.stops[0] = context.AfterFunc(ctx, func() { c.cancel(ctx) })
+		c.stops[1] = context.AfterFunc(reqCtx, func() { c.cancel(reqCtx) })
+		c.mu.Unlock()
+	}
+	return c
+}
+
+// cancel parent 结束时结束 c，并取消在另一个 context 上的注册
+func (c *mergedContext) cancel(parent context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = parent.Err()
+	close(c.done)
+	for _, stop := range c.stops {
+		stop()
+	}
+}
+
+// Deadline 实现 context.Context
+func (c *mergedContext) Deadline() (time.Time, bool) {
+	if c.signal != nil {
+		return c.signal.Deadline()
+	}
+	var deadline, ok = c.ctx.Deadline()
+	if reqDeadline, reqOk := c.reqCtx.Deadline(); reqOk && (!ok || reqDeadline.Before(deadline)) {
+		return reqDeadline, true
+	}
+	return deadline, ok
+}
+
+// Done 实现 context.Context
+func (c *mergedContext) Done() <-chan struct{} {
+	if c.signal != nil {
+		return c.signal.Done()
+	}
+	return c.done
+}
+
+// Err 实现 context.Context
+func (c *mergedContext) Err() error {
+	if c.signal != nil {
+		return c.signal.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Value 实现 context.Context
+func (c *mergedContext) Value(key any) any {
+	if v := c.ctx.Value(key); v != nil {
+		return v
+	}
+	return c.reqCtx.Value(key)
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"github.com/goclover/seed"
+	"net/http"
+)
+
+// ResponseHooksCtxKey is the context.Context key to store the per-request
+// response hooks registry.
+var ResponseHooksCtxKey = &seed.ContextKey{Name: "ResponseHooks"}
+
+// ResponseHooks is a middleware that wraps the response writer once with a
+// WrapResponseWriter and lets later middlewares register hooks on it through
+// OnBeforeWriteHeader and OnAfterResponse, so they can cooperate without each
+// wrapping the writer again.
+//
+// It should go before any middleware that registers hooks. Example:
+//
+//	r := seed.NewRouter()
+//	r.Use(middleware.ResponseHooks)
+//	r.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+//		middleware.OnBeforeWriteHeader(req, func(w middleware.WrapResponseWriter, code int) {
+//			w.Header().Set("X-Frame-Options", "DENY")
+//		})
+//		return next.Next(ctx, w, req)
+//	})
+func ResponseHooks(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+	if getResponseHooks(req) != nil {
+		return next.Next(ctx, w, req)
+	}
+	var ww = NewWrapResponseWriter(w, req.ProtoMajor)
+	var hooks = &responseHooks{writer: ww}
+	var bw = ww.(interface{ base() *basicWriter }).base()
+	bw.hooks = hooks
+
+	ctx = context.WithValue(ctx, ResponseHooksCtxKey, hooks)
+	var ok = next.Next(ctx, ww, req.WithContext(ctx))
+
+	// net/http would write an implicit 200 after the handler returns, bypassing
+	// the before hooks, so run them here for handlers that wrote nothing. The
+	// status line itself is left to net/http, so middlewares outside this one
+	// can still write another status, e.g. Timeout. A panic skips both, the
+	// status is then up to a Recoverer placed before or after this middleware.
+	if !bw.hijacked {
+		bw.implicitHeader()
+	}
+	hooks.afterResponse()
+	return ok
+}
+
+// OnBeforeWriteHeader registers f to run right before the status line is sent,
+// whether by WriteHeader, the first Write or a Flush, with the status code
+// being sent. For handlers that write nothing they run when ResponseHooks
+// returns, with the implicit 200 net/http sends unless a middleware outside
+// ResponseHooks writes another status. Headers set on w in f are sent with the response. Hooks run in
+// the order they were registered and do not run for hijacked connections.
+//
+// Hooks may only change headers: Write on w returns ErrWriteInHook, WriteHeader
+// and Flush do nothing.
+//
+// It returns false if the ResponseHooks middleware is not installed.
+func OnBeforeWriteHeader(req *http.Request, f func(w WrapResponseWriter, code int)) bool {
+	var hooks = getResponseHooks(req)
+	if hooks == nil {
+		return false
+	}
+	hooks.before = append(hooks.before, f)
+	return true
+}
+
+// OnAfterResponse registers f to run after the handler has returned and the
+// response is complete, including streamed responses. Status and BytesWritten
+// of w hold the final values. Hooks run in the order they were registered and
+// do not run if the handler panics.
+//
+// It returns false if the ResponseHooks middleware is not installed.
+func OnAfterResponse(req *http.Request, f func(w WrapResponseWriter)) bool {
+	var hooks = getResponseHooks(req)
+	if hooks == nil {
+		return false
+	}
+	hooks.after = append(hooks.after, f)
+	return true
+}
+
+// getResponseHooks returns the hooks registry installed by ResponseHooks.
+func getResponseHooks(req *http.Request) *responseHooks {
+	hooks, _ := req.Context().Value(ResponseHooksCtxKey).(*responseHooks)
+	return hooks
+}
+
+// responseHooks holds the hooks registered during a single request. Hooks are
+// expected to be registered from the goroutine serving the request.
+type responseHooks struct {
+	writer WrapResponseWriter
+	before []func(w WrapResponseWriter, code int)
+	after  []func(w WrapResponseWriter)
+}
+
+func (h *responseHooks) beforeWriteHeader(code int) {
+	for _, f := range h.before {
+		f(h.writer, code)
+	}
+}
+
+func (h *responseHooks) afterResponse() {
+	for _, f := range h.after {
+		f(h.writer)
+	}
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"github.com/goclover/seed"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResponseHooks(t *testing.T) {
+	var trace []string
+	var r = seed.NewRouter()
+	r.Use(ResponseHooks)
+	r.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		OnBeforeWriteHeader(req, func(w WrapResponseWriter, code int) {
+			trace = append(trace, "before")
+			w.Header().Set("X-Frame-Options", "DENY")
+		})
+		OnAfterResponse(req, func(w WrapResponseWriter) {
+			trace = append(trace, "after")
+			var bytes = map[string]int{"/stream": 4, "/empty": 0}[req.URL.Path]
+			if w.Status() != http.StatusOK || w.BytesWritten() != bytes {
+				t.Errorf("want 200 and %d bytes, got %d %d", bytes, w.Status(), w.BytesWritten())
+			}
+		})
+		return next.Next(ctx, w, req)
+	})
+	// nested ResponseHooks and Logger wrapping the writer again reuse the outer registry
+	r.Use(ResponseHooks)
+	r.Use(Logger)
+	r.HandleStd(seed.MethodGet, "/stream", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("ab"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("cd"))
+		trace = append(trace, "handler")
+	}))
+	r.HandleStd(seed.MethodGet, "/empty", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		trace = append(trace, "handler")
+	}))
+
+	for _, path := range []string{"/stream", "/empty"} {
+		trace = nil
+		var w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, path, nil))
+		if got := w.Header().Get("X-Frame-Options"); got != "DENY" {
+			t.Errorf("%s: want header set before status line, got %q", path, got)
+		}
+		var want = []string{"handler", "before", "after"}
+		if path == "/stream" {
+			want = []string{"before", "handler", "after"}
+		}
+		if !reflect.DeepEqual(trace, want) {
+			t.Errorf("%s: want %v, got %v", path, want, trace)
+		}
+	}
+
+	if OnAfterResponse(httptest.NewRequest(seed.MethodGet, "/", nil), func(w WrapResponseWriter) {}) {
+		t.Fatal("want false without ResponseHooks middleware")
+	}
+}
+
+func TestResponseHooksStatus(t *testing.T) {
+	var codes []int
+	var writeErr error
+	var r = seed.NewRouter()
+	r.Use(ResponseHooks)
+	r.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		OnBeforeWriteHeader(req, func(w WrapResponseWriter, code int) {
+			codes = append(codes, code)
+			w.Header().Set("X-Status", http.StatusText(code))
+			// body writes, status changes and flushes are ignored in hooks
+			_, writeErr = w.Write([]byte("hook"))
+			w.WriteHeader(http.StatusTeapot)
+			w.(http.Flusher).Flush()
+		})
+		return next.Next(ctx, w, req)
+	})
+	r.HandleStd(seed.MethodGet, "/missing", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("missing"))
+	}))
+
+	var w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, "/missing", nil))
+	if !reflect.DeepEqual(codes, []int{http.StatusNotFound}) || writeErr != ErrWriteInHook {
+		t.Fatalf("want hook called once with 404 and write rejected, got %v %v", codes, writeErr)
+	}
+	if w.Code != http.StatusNotFound || w.Body.String() != "missing" || w.Header().Get("X-Status") != "Not Found" {
+		t.Fatalf("want 404 with handler body, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+}
+
+// hijackableRecorder is a ResponseRecorder that can be hijacked.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	err      error
+	hijacked bool
+}
+
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h.err != nil {
+		return nil, nil, h.err
+	}
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseHooksHijack(t *testing.T) {
+	var hooks []string
+	var r = seed.NewRouter()
+	r.Use(ResponseHooks)
+	r.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		OnBeforeWriteHeader(req, func(w WrapResponseWriter, code int) { hooks = append(hooks, "before") })
+		OnAfterResponse(req, func(w WrapResponseWriter) { hooks = append(hooks, "after") })
+		return next.Next(ctx, w, req)
+	})
+	r.HandleStd(seed.MethodGet, "/hijack", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _, _ = w.(http.Hijacker).Hijack()
+	}))
+	r.HandleStd(seed.MethodGet, "/controller", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("want a writer without Hijack for HTTP/2 requests")
+		}
+		_, _, _ = http.NewResponseController(w).Hijack()
+	}))
+
+	var cases = []struct {
+		path       string
+		protoMajor int
+		err        error
+		want       []string
+	}{
+		{"/hijack", 1, nil, []string{"after"}},
+		{"/hijack", 1, http.ErrNotSupported, []string{"before", "after"}},
+		{"/controller", 2, nil, []string{"after"}},
+		{"/controller", 2, http.ErrNotSupported, []string{"before", "after"}},
+	}
+	for _, c := range cases {
+		hooks = nil
+		var w = &hijackableRecorder{ResponseRecorder: httptest.NewRecorder(), err: c.err}
+		var req = httptest.NewRequest(seed.MethodGet, c.path, nil)
+		req.ProtoMajor = c.protoMajor
+		r.ServeHTTP(w, req)
+		if w.hijacked != (c.err == nil) || !reflect.DeepEqual(hooks, c.want) {
+			t.Errorf("%s HTTP/%d err=%v: want %v, got hijacked=%v %v", c.path, c.protoMajor, c.err, c.want, w.hijacked, hooks)
+		}
+	}
+}
+
+func TestResponseHooksRecoverer(t *testing.T) {
+	var errorWriter = RecovererErrorWriter
+	RecovererErrorWriter = io.Discard
+	defer func() { RecovererErrorWriter = errorWriter }()
+
+	var hooks []string
+	var register = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		OnBeforeWriteHeader(req, func(w WrapResponseWriter, code int) { hooks = append(hooks, "before "+strconv.Itoa(code)) })
+		OnAfterResponse(req, func(w WrapResponseWriter) { hooks = append(hooks, "after "+strconv.Itoa(w.Status())) })
+		return next.Next(ctx, w, req)
+	}
+	var panicking = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	})
+
+	// Recoverer outside ResponseHooks writes the 500 to the original writer
+	var outer = seed.NewRouter()
+	outer.Use(Recoverer, ResponseHooks, register)
+	outer.HandleStd(seed.MethodGet, "/panic", panicking)
+
+	// Recoverer inside ResponseHooks writes the 500 through the hooks
+	var inner = seed.NewRouter()
+	inner.Use(ResponseHooks, register, Recoverer)
+	inner.HandleStd(seed.MethodGet, "/panic", panicking)
+
+	for name, c := range map[string]struct {
+		r    seed.Router
+		want []string
+	}{
+		"outer": {outer, nil},
+		"inner": {inner, []string{"before 500", "after 500"}},
+	} {
+		hooks = nil
+		var w = httptest.NewRecorder()
+		c.r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, "/panic", nil))
+		if w.Code != http.StatusInternalServerError || !reflect.DeepEqual(hooks, c.want) {
+			t.Errorf("%s: want 500 and %v, got %d %v", name, c.want, w.Code, hooks)
+		}
+	}
+}
+
+func TestResponseHooksOuterStatus(t *testing.T) {
+	var hooks []string
+	var register = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		OnBeforeWriteHeader(req, func(w WrapResponseWriter, code int) {
+			hooks = append(hooks, "before "+strconv.Itoa(code))
+			w.Header().Set("X-Frame-Options", "DENY")
+		})
+		return next.Next(ctx, w, req)
+	}
+	var unavailable = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next seed.MiddleWareQueue) bool {
+		var ok = next.Next(ctx, w, req)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return ok
+	}
+	var waiting = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	})
+	var silent = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	for name, c := range map[string]struct {
+		outer   seed.MiddlewareFunc
+		handler http.Handler
+		code    int
+	}{
+		"timeout": {Timeout(5 * time.Millisecond), waiting, http.StatusGatewayTimeout},
+		"custom":  {unavailable, silent, http.StatusServiceUnavailable},
+	} {
+		hooks = nil
+		var r = seed.NewRouter()
+		r.Use(c.outer, ResponseHooks, register)
+		r.HandleStd(seed.MethodGet, "/", c.handler)
+		var w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, "/", nil))
+		if w.Code != c.code || w.Header().Get("X-Frame-Options") != "DENY" || !reflect.DeepEqual(hooks, []string{"before 200"}) {
+			t.Errorf("%s: want %d with hook headers, got %d %v %v", name, c.code, w.Code, w.Header(), hooks)
+		}
+	}
+}
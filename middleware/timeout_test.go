@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"github.com/goclover/seed"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	var r = seed.NewRouter()
+	r.Use(Timeout(10 * time.Millisecond))
+	r.HandleFunc(seed.MethodGet, "/slow", func(ctx context.Context, req seed.Request) seed.Response {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("want deadline on handler ctx")
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Error("want handler ctx canceled by Timeout")
+		}
+		return nil
+	})
+	r.HandleFunc(seed.MethodGet, "/fast", func(ctx context.Context, req seed.Request) seed.Response {
+		if ctx.Err() != nil {
+			t.Errorf("want live ctx, got %v", ctx.Err())
+		}
+		return nil
+	})
+
+	var w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("want %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(seed.MethodGet, "/fast", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+}
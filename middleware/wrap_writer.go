@@ -5,11 +5,16 @@ package middleware
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 )
 
+// ErrWriteInHook is returned by Write when the response body is written from
+// an OnBeforeWriteHeader hook, which may only change headers.
+var ErrWriteInHook = errors.New("middleware: response written from a before write header hook")
+
 // NewWrapResponseWriter wraps an http.ResponseWriter, returning a proxy that allows you to
 // hook into various parts of the response process.
 func NewWrapResponseWriter(w http.ResponseWriter, protoMajor int) WrapResponseWriter {
@@ -59,7 +64,10 @@ type WrapResponseWriter interface {
 	// io.Writer. It is illegal for the tee'd writer to be modified
 	// concurrently with writes.
 	Tee(io.Writer)
-	// Unwrap returns the original proxied target.
+	// Unwrap returns the original proxied target. With ResponseHooks
+	// installed the target is returned behind a thin proxy that records
+	// hijacks made through http.ResponseController; its Unwrap returns the
+	// target itself.
 	Unwrap() http.ResponseWriter
 }
 
@@ -71,17 +79,24 @@ type basicWriter struct {
 	code        int
 	bytes       int
 	tee         io.Writer
+	hooks       *responseHooks
+	inHooks     bool
+	hijacked    bool
 }
 
 func (b *basicWriter) WriteHeader(code int) {
 	if !b.wroteHeader {
 		b.code = code
 		b.wroteHeader = true
+		b.beforeWriteHeader(code)
 		b.ResponseWriter.WriteHeader(code)
 	}
 }
 
 func (b *basicWriter) Write(buf []byte) (int, error) {
+	if b.inHooks {
+		return 0, ErrWriteInHook
+	}
 	b.maybeWriteHeader()
 	n, err := b.ResponseWriter.Write(buf)
 	if b.tee != nil {
@@ -101,6 +116,29 @@ func (b *basicWriter) maybeWriteHeader() {
 	}
 }
 
+// implicitHeader records the implicit 200 net/http sends for handlers that
+// wrote nothing and runs the hooks for it, without sending the status line.
+func (b *basicWriter) implicitHeader() {
+	if b.wroteHeader {
+		return
+	}
+	b.code = http.StatusOK
+	b.wroteHeader = true
+	b.beforeWriteHeader(http.StatusOK)
+}
+
+// beforeWriteHeader runs the hooks registered through OnBeforeWriteHeader.
+func (b *basicWriter) beforeWriteHeader(code int) {
+	if b.hooks == nil {
+		return
+	}
+	// the status line is not sent yet, so hooks must not write or flush the
+	// body, which would send an implicit 200 first.
+	b.inHooks = true
+	b.hooks.beforeWriteHeader(code)
+	b.inHooks = false
+}
+
 func (b *basicWriter) Status() int {
 	return b.code
 }
@@ -114,18 +152,42 @@ func (b *basicWriter) Tee(w io.Writer) {
 }
 
 func (b *basicWriter) Unwrap() http.ResponseWriter {
+	if b.hooks != nil {
+		return &hijackRecorder{ResponseWriter: b.ResponseWriter, b: b}
+	}
 	return b.ResponseWriter
 }
 
+// flush sends the status line if needed and flushes the proxied target.
+func (b *basicWriter) flush() {
+	b.maybeWriteHeader()
+	if b.inHooks {
+		return
+	}
+	b.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijack hijacks the proxied target and records a successful hijack, so
+// ResponseHooks does not write a status line on the hijacked connection.
+func (b *basicWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := b.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		b.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (b *basicWriter) base() *basicWriter {
+	return b
+}
+
 // flushWriter ...
 type flushWriter struct {
 	basicWriter
 }
 
 func (f *flushWriter) Flush() {
-	f.wroteHeader = true
-	fl := f.basicWriter.ResponseWriter.(http.Flusher)
-	fl.Flush()
+	f.flush()
 }
 
 var _ http.Flusher = &flushWriter{}
@@ -136,8 +198,7 @@ type hijackWriter struct {
 }
 
 func (f *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hj := f.basicWriter.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+	return f.hijack()
 }
 
 var _ http.Hijacker = &hijackWriter{}
@@ -148,14 +209,11 @@ type flushHijackWriter struct {
 }
 
 func (f *flushHijackWriter) Flush() {
-	f.wroteHeader = true
-	fl := f.basicWriter.ResponseWriter.(http.Flusher)
-	fl.Flush()
+	f.flush()
 }
 
 func (f *flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hj := f.basicWriter.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+	return f.hijack()
 }
 
 var _ http.Flusher = &flushHijackWriter{}
@@ -170,14 +228,11 @@ type httpFancyWriter struct {
 }
 
 func (f *httpFancyWriter) Flush() {
-	f.wroteHeader = true
-	fl := f.basicWriter.ResponseWriter.(http.Flusher)
-	fl.Flush()
+	f.flush()
 }
 
 func (f *httpFancyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hj := f.basicWriter.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+	return f.hijack()
 }
 
 func (f *http2FancyWriter) Push(target string, opts *http.PushOptions) error {
@@ -185,7 +240,7 @@ func (f *http2FancyWriter) Push(target string, opts *http.PushOptions) error {
 }
 
 func (f *httpFancyWriter) ReadFrom(r io.Reader) (int64, error) {
-	if f.basicWriter.tee != nil {
+	if f.basicWriter.tee != nil || f.basicWriter.inHooks {
 		n, err := io.Copy(&f.basicWriter, r)
 		f.basicWriter.bytes += int(n)
 		return n, err
@@ -211,9 +266,29 @@ type http2FancyWriter struct {
 }
 
 func (f *http2FancyWriter) Flush() {
-	f.wroteHeader = true
-	fl := f.basicWriter.ResponseWriter.(http.Flusher)
-	fl.Flush()
+	f.flush()
 }
 
 var _ http.Flusher = &http2FancyWriter{}
+
+// hijackRecorder is returned by Unwrap when ResponseHooks is installed. It
+// lets http.ResponseController hijack the original target through writers
+// that do not implement http.Hijacker themselves, and records the hijack.
+type hijackRecorder struct {
+	http.ResponseWriter
+	b *basicWriter
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(h.ResponseWriter).Hijack()
+	if err == nil {
+		h.b.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (h *hijackRecorder) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+var _ http.Hijacker = &hijackRecorder{}
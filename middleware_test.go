@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMiddleware(t *testing.T) {
@@ -25,3 +28,324 @@ func TestMiddleware(t *testing.T) {
 	fmt.Printf("%+v\n", ms)
 	ms.Next(context.Background(), nil, nil)
 }
+
+func TestMiddlewareChain(t *testing.T) {
+	var trace []string
+	var mark = func(name string) MiddlewareFunc {
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			trace = append(trace, name)
+			return next.Next(ctx, w, req)
+		}
+	}
+	var rs = NewRouter().(*router)
+	rs.Use(mark("a"))
+	rs.Use(mark("b"))
+	rs.Use(mark("c"))
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		trace = append(trace, "handler")
+		return nil
+	}
+	rs.HandleFunc(MethodGet, "/one", h, mark("one"))
+	rs.HandleFunc(MethodGet, "/two", h, mark("two"))
+
+	rs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(MethodGet, "/one", nil))
+	if want := []string{"a", "b", "c", "one", "handler"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("want %v, got %v", want, trace)
+	}
+
+	var noop MiddlewareFunc = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(ctx, w, req)
+	}
+	var w = httptest.NewRecorder()
+	var req = httptest.NewRequest(MethodGet, "/", nil)
+	var allocs = func(ms ...MiddlewareFunc) float64 {
+		var handler = rs.TransHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}), ms...)
+		return testing.AllocsPerRun(100, func() { handler.ServeHTTP(w, req) })
+	}
+	// one allocation per request records the contexts, whatever the chain length
+	if one, many := allocs(noop), allocs(noop, noop, noop, noop, noop, noop); one > 1 || many != one {
+		t.Fatalf("want at most 1 alloc per request, got %v with 1 middleware and %v with 6", one, many)
+	}
+}
+
+func TestMiddlewareContext(t *testing.T) {
+	var ctxKey, reqKey = &ContextKey{Name: "ctx"}, &ContextKey{Name: "req"}
+	var values = func(ctx context.Context) string {
+		return fmt.Sprint(ctx.Value(ctxKey), ",", ctx.Value(reqKey))
+	}
+	var rs = NewRouter()
+	// only changes ctx
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(context.WithValue(ctx, ctxKey, "a"), w, req)
+	})
+	// only changes req.Context()
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(ctx, w, req.WithContext(context.WithValue(req.Context(), reqKey, "b")))
+	})
+	var seen []string
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		seen = append(seen, values(ctx), values(req.Context()))
+		return next.Next(ctx, w, req)
+	})
+	var cancel context.CancelFunc
+	rs.HandleFunc(MethodGet, "/ctx", func(ctx context.Context, req Request) Response {
+		seen = append(seen, values(ctx), values(req.HTTPRequest().Context()))
+		return nil
+	}, func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		// cancellation set only on ctx reaches the handler too
+		ctx, cancel = context.WithCancel(ctx)
+		cancel()
+		return next.Next(ctx, w, req)
+	}, func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		if req.Context().Err() == nil {
+			t.Error("want canceled request context")
+		}
+		return next.Next(ctx, w, req)
+	})
+
+	rs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(MethodGet, "/ctx", nil))
+	if want := []string{"a,b", "a,b", "a,b", "a,b"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("want %v, got %v", want, seen)
+	}
+}
+
+func TestMiddlewareContextOverride(t *testing.T) {
+	var key = &ContextKey{Name: "key"}
+	var set = func(v string) MiddlewareFunc {
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			ctx = context.WithValue(ctx, key, v)
+			return next.Next(ctx, w, req.WithContext(ctx))
+		}
+	}
+	var cases = map[string]MiddlewareFunc{
+		// overrides through req.WithContext only
+		"req": func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			return next.Next(ctx, w, req.WithContext(context.WithValue(req.Context(), key, "inner")))
+		},
+		// overrides through ctx only
+		"ctx": func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			return next.Next(context.WithValue(ctx, key, "inner"), w, req)
+		},
+		// overrides both, ctx wins
+		"both": func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			return next.Next(context.WithValue(ctx, key, "inner"), w, req.WithContext(context.WithValue(req.Context(), key, "req")))
+		},
+	}
+	for name, m := range cases {
+		var got []any
+		var rs = NewRouter()
+		rs.Use(set("outer"), m)
+		rs.HandleFunc(MethodGet, "/", func(ctx context.Context, req Request) Response {
+			got = append(got, ctx.Value(key), req.HTTPRequest().Context().Value(key))
+			return nil
+		})
+		rs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(MethodGet, "/", nil))
+		if want := []any{"inner", "inner"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want %v, got %v", name, want, got)
+		}
+
+		// the same through an exported queue
+		got = nil
+		var q = NewMiddleWareQueue(set("outer"), m, func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			got = append(got, ctx.Value(key), req.Context().Value(key))
+			return next.Next(ctx, w, req)
+		})
+		var req = httptest.NewRequest(MethodGet, "/", nil)
+		if q.Next(req.Context(), httptest.NewRecorder(), req) || !reflect.DeepEqual(got, []any{"inner", "inner"}) {
+			t.Errorf("%s queue: want inner, got %v", name, got)
+		}
+	}
+}
+
+func TestMergeContext(t *testing.T) {
+	var wait = func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+	var sameDeadline = func(a, b context.Context) bool {
+		var da, oka = a.Deadline()
+		var db, okb = b.Deadline()
+		return oka == okb && da.Equal(db)
+	}
+
+	// canceled by the request context deadline while ctx only has a cancel func
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var reqCtx, reqCancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer reqCancel()
+	var merged = mergeContext(ctx, reqCtx)
+	if !sameDeadline(merged, reqCtx) {
+		t.Fatal("want the request context deadline")
+	}
+	if err := wait(merged); err != context.DeadlineExceeded {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+
+	// canceled by the request context before the later deadline of ctx
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	reqCtx, reqCancel = context.WithCancel(context.Background())
+	merged = mergeContext(ctx, reqCtx)
+	reqCancel()
+	if err := wait(merged); err != context.Canceled {
+		t.Fatalf("want canceled, got %v", err)
+	}
+	if !sameDeadline(merged, ctx) {
+		t.Fatal("want the earliest deadline")
+	}
+
+	// canceled by ctx, the earlier of both deadlines
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	reqCtx, reqCancel = context.WithTimeout(context.Background(), time.Hour)
+	defer reqCancel()
+	if err := wait(mergeContext(ctx, reqCtx)); err != context.DeadlineExceeded {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+
+	// values added to the same context share its done channel
+	reqCtx, reqCancel = context.WithCancel(context.Background())
+	defer reqCancel()
+	merged = mergeContext(context.WithValue(reqCtx, &ContextKey{Name: "a"}, 1), context.WithValue(reqCtx, &ContextKey{Name: "b"}, 2))
+	if merged.Done() != reqCtx.Done() {
+		t.Fatal("want the shared done channel")
+	}
+}
+
+func TestStdMiddleware(t *testing.T) {
+	var key = &ContextKey{Name: "std"}
+	var trace []string
+	var std = func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				trace = append(trace, name)
+				if req.Header.Get("Deny") == name {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), key, name)))
+			})
+		}
+	}
+	var rs = NewRouter()
+	rs.Use(StdMiddleware(std("outer")))
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		trace = append(trace, fmt.Sprint("seed:", ctx.Value(key)))
+		return next.Next(ctx, w, req)
+	})
+	rs.Use(StdMiddleware(std("inner")))
+	rs.HandleFunc(MethodGet, "/std", func(ctx context.Context, req Request) Response {
+		trace = append(trace, fmt.Sprint("handler:", ctx.Value(key)))
+		return nil
+	})
+
+	var w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(MethodGet, "/std", nil))
+	if want := []string{"outer", "seed:outer", "inner", "handler:inner"}; w.Code != http.StatusOK || !reflect.DeepEqual(trace, want) {
+		t.Fatalf("want 200 %v, got %d %v", want, w.Code, trace)
+	}
+
+	trace, w = nil, httptest.NewRecorder()
+	var req = httptest.NewRequest(MethodGet, "/std", nil)
+	req.Header.Set("Deny", "inner")
+	rs.ServeHTTP(w, req)
+	if want := []string{"outer", "seed:outer", "inner"}; w.Code != http.StatusForbidden || !reflect.DeepEqual(trace, want) {
+		t.Fatalf("want 403 %v, got %d %v", want, w.Code, trace)
+	}
+
+	// seed middleware exported to a plain http.Handler
+	var auth MiddlewareFunc = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		if req.Header.Get("Deny") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return next.Next(context.WithValue(ctx, key, "seed"), w, req)
+	}
+	var got any
+	var h = auth.Std()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Context().Value(key)
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(MethodGet, "/", nil))
+	if w.Code != http.StatusOK || got != "seed" {
+		t.Fatalf("want 200 seed, got %d %v", w.Code, got)
+	}
+	got, w = nil, httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || got != nil {
+		t.Fatalf("want 401 and next skipped, got %d %v", w.Code, got)
+	}
+}
+
+func TestConditionalMiddleware(t *testing.T) {
+	var trace []string
+	var mark = func(name string) MiddlewareFunc {
+		return func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+			trace = append(trace, name)
+			return next.Next(ctx, w, req)
+		}
+	}
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		trace = append(trace, "handler")
+		return nil
+	}
+	var rs = NewRouter()
+	rs.Use(Unless("/health", mark("logger")))
+	rs.Use(When(func(req *http.Request) bool { return req.Header.Get("Debug") != "" }, mark("debug")))
+	rs.HandleFunc(MethodGet, "/health", h)
+	rs.HandleFunc(MethodGet, "/health/live", h)
+	rs.HandleFunc(MethodGet, "/healthz", h)
+	rs.Group("/api", func(r Router) {
+		r.HandleFunc(MethodGet, "/user", h)
+		r.HandleFunc(MethodGet, "/login", h).Skip("auth").Skip("audit")
+	}, Named("auth", mark("auth")), Named("audit", mark("audit")))
+
+	var cases = []struct {
+		path  string
+		debug bool
+		want  []string
+	}{
+		{"/health", false, []string{"handler"}},
+		{"/health", true, []string{"debug", "handler"}},
+		{"/health/live", false, []string{"handler"}},
+		{"/healthz", false, []string{"logger", "handler"}},
+		{"/HEALTH", false, []string{"handler"}},
+		{"/Health/Live", false, []string{"handler"}},
+		{"/api/user", false, []string{"logger", "auth", "audit", "handler"}},
+		{"/api/login", false, []string{"logger", "handler"}},
+	}
+	for _, c := range cases {
+		trace = nil
+		var req = httptest.NewRequest(MethodGet, c.path, nil)
+		if c.debug {
+			req.Header.Set("Debug", "1")
+		}
+		rs.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(trace, c.want) {
+			t.Errorf("%s debug=%v: want %v, got %v", c.path, c.debug, c.want, trace)
+		}
+	}
+
+	// the prefix is compared the way the router matched the request
+	var strict = NewRouter(WithCaseSensitive(), WithRawPath())
+	strict.Use(Unless("/files/a", mark("logger")))
+	strict.HandleFunc(MethodGet, "/files/:name", h)
+	strict.HandleFunc(MethodGet, "/FILES/:name", h)
+	strict.HandleFunc(MethodGet, "/files/:name/*rest", h)
+	for path, want := range map[string][]string{
+		"/files/a":     {"handler"},
+		"/files/%61/b": {"handler"},
+		"/FILES/a":     {"logger", "handler"},
+		"/files/a%2Fb": {"logger", "handler"},
+	} {
+		trace = nil
+		strict.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(MethodGet, path, nil))
+		if !reflect.DeepEqual(trace, want) {
+			t.Errorf("strict %s: want %v, got %v", path, want, trace)
+		}
+	}
+}
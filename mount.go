@@ -0,0 +1,78 @@
+package seed
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginalPathCtxKey 挂载的 handler 收到的请求中，剥离前缀前的原始 path 在 context.Context 中的 Key
+var OriginalPathCtxKey = &ContextKey{Name: "OriginalPath"}
+
+// mountPathParam 挂载路由末尾通配段的参数名
+const mountPathParam = "mountpath"
+
+// OriginalPath 获取挂载前的原始请求 path，不是挂载的请求时返回空值
+//
+//	多层挂载时返回最外层的原始 path
+func OriginalPath(ctx context.Context) string {
+	p, _ := ctx.Value(OriginalPathCtxKey).(string)
+	return p
+}
+
+// Mount 实现 Router
+func (r *router) Mount(prefix string, handler http.Handler, ms ...MiddlewareFunc) RouteSetter {
+	return mustRegister(r.mount(prefix, handler, false, ms...))
+}
+
+// TryMount 实现 Router
+func (r *router) TryMount(prefix string, handler http.Handler, ms ...MiddlewareFunc) (RouteSetter, error) {
+	return r.mount(prefix, handler, true, ms...)
+}
+
+// mount 注册挂载路由，checkAmbiguous 为 true 时检查有歧义的路由
+func (r *router) mount(prefix string, handler http.Handler, checkAmbiguous bool, ms ...MiddlewareFunc) (RouteSetter, error) {
+	var pattern = strings.TrimSuffix(prefix, "/") + "/*" + mountPathParam
+	var depth = len(strings.FieldsFunc(r.prefix+prefix, func(c rune) bool { return c == '/' }))
+	var h http.HandlerFunc = func(w http.ResponseWriter, req *http.Request) {
+		// 挂载的 handler 不是当前路由，清除当前路由及其参数
+		var ctx = WithParams(WithRoute(req.Context(), nil), nil)
+		if OriginalPath(ctx) == "" {
+			ctx = context.WithValue(ctx, OriginalPathCtxKey, req.URL.Path)
+		}
+		var mreq = req.WithContext(ctx)
+		var u = *req.URL
+		mreq.URL = &u
+		if u.RawPath != "" {
+			u.RawPath = stripSegments(u.RawPath, depth)
+			if unescaped, err := url.PathUnescape(u.RawPath); err == nil {
+				u.Path = unescaped
+			}
+		} else {
+			u.Path = stripSegments(u.Path, depth)
+		}
+		handler.ServeHTTP(w, mreq)
+	}
+	var rs, err = r.handle(MethodAny, pattern, h, checkAmbiguous, ms...)
+	if err != nil {
+		return nil, err
+	}
+	return rs.Operation(Operation{Hidden: true}), nil
+}
+
+// stripSegments 去掉路径开头的 n 个分段，剩余部分总是以 / 开头
+func stripSegments(p string, n int) string {
+	for ; n > 0; n-- {
+		p = strings.TrimLeft(p, "/")
+		if i := strings.IndexByte(p, '/'); i >= 0 {
+			p = p[i:]
+		} else {
+			p = ""
+		}
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
@@ -0,0 +1,531 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OperationMetaKey 路由的 OpenAPI 描述在路由元数据中的 key，详见 RouteSetter.Operation
+const OperationMetaKey = "seed.openapi.operation"
+
+// openAPIVersion 生成的文档使用的 OpenAPI 版本
+const openAPIVersion = "3.1.0"
+
+// Operation 路由的 OpenAPI 描述
+type Operation struct {
+	// OperationID 默认使用路由名称，重复时会加上方法后缀，如 saveUser_patch
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	// Hidden 为 true 时不出现在文档中
+	Hidden bool
+
+	// Request 请求体的类型，使用该类型的值表示，如 User{} 或 (*User)(nil)
+	Request any
+
+	// Response 200 响应体的类型，用法与 Request 相同
+	Response any
+
+	// Responses 其他状态码的响应体类型，值为 nil 时只有描述没有响应体
+	Responses map[int]any
+}
+
+// OpenAPIInfo 文档的基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPI OpenAPI 3.1 文档
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components *OpenAPIComponents                      `json:"components,omitempty"`
+}
+
+// OpenAPIOperation 文档中的一个接口
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Host        string                      `json:"x-host,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter 接口参数
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody 请求体
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse 响应
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType 请求体或响应体的内容
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIComponents 文档中可复用的定义
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+// OpenAPISchema JSON Schema
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// NewOpenAPI 根据路由生成 OpenAPI 3.1 文档
+//
+//	路由通过 RouteSetter.Operation 设置描述，请求体、响应体的类型通过反射生成 Schema
+//	结构体按 json tag 生成字段，放在 components 中通过 $ref 引用
+//	未设置描述的 HEAD、OPTIONS、CONNECT、TRACE 路由、禁用的路由以及 Operation.Hidden 的路由不会出现在文档中
+//	绑定 host 的路由通过 x-host 标明 host，同一 path 和方法只保留一个接口，不绑定 host 的路由优先，其次是靠前的路由
+func NewOpenAPI(info OpenAPIInfo, routes []Route) *OpenAPI {
+	var doc = &OpenAPI{OpenAPI: openAPIVersion, Info: info, Paths: map[string]map[string]*OpenAPIOperation{}}
+	var g = &schemaGenerator{schemas: map[string]*OpenAPISchema{}, names: map[reflect.Type]string{}}
+	var ids = map[string]bool{}
+	routes = slices.Clone(routes)
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].Host() == "" && routes[j].Host() != ""
+	})
+	for _, route := range routes {
+		var op, documented = routeOperation(route)
+		if op.Hidden || route.Disabled() || !documented && !documentedMethod(route.Method()) {
+			continue
+		}
+		var p, params = openAPIPath(route.Path())
+		var method = strings.ToLower(route.Method())
+		if _, taken := doc.Paths[p][method]; taken {
+			continue
+		}
+		var o = &OpenAPIOperation{
+			OperationID: operationID(ids, op.OperationID, route),
+			Host:        route.Host(),
+			Summary:     op.Summary,
+			Description: op.Description,
+			Tags:        op.Tags,
+			Deprecated:  op.Deprecated,
+			Parameters:  params,
+			Responses:   map[string]*OpenAPIResponse{},
+		}
+		if op.Request != nil {
+			o.RequestBody = &OpenAPIRequestBody{Required: true, Content: g.content(op.Request)}
+		}
+		o.Responses["200"] = &OpenAPIResponse{Description: http.StatusText(http.StatusOK), Content: g.content(op.Response)}
+		for code, v := range op.Responses {
+			o.Responses[strconv.Itoa(code)] = &OpenAPIResponse{Description: http.StatusText(code), Content: g.content(v)}
+		}
+
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[p][method] = o
+	}
+	if len(g.schemas) > 0 {
+		doc.Components = &OpenAPIComponents{Schemas: g.schemas}
+	}
+	return doc
+}
+
+// JSON 返回 JSON 格式的文档
+func (doc *OpenAPI) JSON() ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// YAML 返回 YAML 格式的文档
+func (doc *OpenAPI) YAML() ([]byte, error) {
+	var bs, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var dec = json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	var v yamlValue
+	if v, err = decodeYAMLValue(dec); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	v.writeBlock(&buf, 0, false)
+	return buf.Bytes(), nil
+}
+
+// OpenAPI 实现 Router
+func (r *router) OpenAPI(path string, info OpenAPIInfo, ms ...MiddlewareFunc) RouteSetter {
+	return mustRegister(r.openAPI(path, info, false, ms...))
+}
+
+// TryOpenAPI 实现 Router
+func (r *router) TryOpenAPI(path string, info OpenAPIInfo, ms ...MiddlewareFunc) (RouteSetter, error) {
+	return r.openAPI(path, info, true, ms...)
+}
+
+// openAPI 注册OpenAPI 文档路由，checkAmbiguous 为 true 时检查有歧义的路由
+func (r *router) openAPI(path string, info OpenAPIInfo, checkAmbiguous bool, ms ...MiddlewareFunc) (RouteSetter, error) {
+	var yaml = strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return &openAPIResponse{doc: NewOpenAPI(info, r.Routes()), yaml: yaml}
+	}
+	var rs, err = r.handle(MethodGet, path, h.Handler(), checkAmbiguous, ms...)
+	if err != nil {
+		return nil, err
+	}
+	return rs.Operation(Operation{Hidden: true}), nil
+}
+
+// Operation 实现 RouteSetter
+func (rs *routeSetter) Operation(op Operation) RouteSetter {
+	return rs.Meta(OperationMetaKey, op)
+}
+
+// openAPIResponse 输出 OpenAPI 文档
+type openAPIResponse struct {
+	doc  *OpenAPI
+	yaml bool
+}
+
+// WriteTo 实现 Response
+func (o *openAPIResponse) WriteTo(w http.ResponseWriter) error {
+	var bs, err = o.doc.JSON()
+	var contentType = "application/json; charset=utf-8"
+	if o.yaml {
+		bs, err = o.doc.YAML()
+		contentType = "application/yaml; charset=utf-8"
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	writeHeaderIfNot(w.Header(), contentType, strconv.Itoa(len(bs)))
+	_, err = w.Write(bs)
+	return err
+}
+
+var _ Response = &openAPIResponse{}
+
+// routeOperation 返回路由设置的 OpenAPI 描述
+func routeOperation(route Route) (Operation, bool) {
+	var v, has = route.Meta(OperationMetaKey)
+	var op, ok = v.(Operation)
+	return op, has && ok
+}
+
+// operationID 返回文档中唯一的 operationId，默认使用路由名称，重复时加上方法后缀，仍然重复时再加上序号
+func operationID(ids map[string]bool, id string, route Route) string {
+	if id == "" {
+		id = route.Name()
+	}
+	if id == "" {
+		return ""
+	}
+	if ids[id] {
+		id += "_" + strings.ToLower(route.Method())
+	}
+	for i, base := 2, id; ids[id]; i++ {
+		id = base + strconv.Itoa(i)
+	}
+	ids[id] = true
+	return id
+}
+
+// documentedMethod 未设置描述时是否出现在文档中
+func documentedMethod(method string) bool {
+	switch method {
+	case MethodHead, MethodOptions, MethodConnect, MethodTrace:
+		return false
+	}
+	return true
+}
+
+// openAPIPath 将路由 pattern 转为 OpenAPI 的 path 模板，并返回其中的路径参数
+//
+//	匿名参数按出现顺序命名为 param1、param2...，末尾通配作为普通的路径参数
+func openAPIPath(pattern string) (string, []*OpenAPIParameter) {
+	var segments = strings.Split(pattern, "/")
+	var params []*OpenAPIParameter
+	for i, segment := range segments {
+		var name, isCatchAll = catchAllName(segment)
+		var constraint, isParam = "", isCatchAll
+		if !isCatchAll {
+			name, constraint, isParam = paramName(segment)
+		}
+		if !isParam {
+			continue
+		}
+		if name == "" {
+			name = fmt.Sprintf("param%d", len(params)+1)
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, &OpenAPIParameter{Name: name, In: "path", Required: true, Schema: constraintSchema(constraint)})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// constraintSchema 返回路径参数约束对应的 Schema
+func constraintSchema(constraint string) *OpenAPISchema {
+	switch constraint {
+	case "":
+		return &OpenAPISchema{Type: "string"}
+	case "int":
+		return &OpenAPISchema{Type: "integer"}
+	case "uuid":
+		return &OpenAPISchema{Type: "string", Format: "uuid"}
+	}
+	if expr, ok := paramConstraints[constraint]; ok {
+		constraint = expr
+	}
+	return &OpenAPISchema{Type: "string", Pattern: "^(?:" + constraint + ")$"}
+}
+
+// schemaGenerator 通过反射生成 Schema，结构体的 Schema 保存在 schemas 中
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema
+	names   map[reflect.Type]string
+}
+
+// timeType time.Time 的类型，按 date-time 格式的字符串处理
+var timeType = reflect.TypeOf(time.Time{})
+
+// content 返回 v 的类型对应的 JSON 内容，v 为 nil 时返回 nil
+func (g *schemaGenerator) content(v any) map[string]OpenAPIMediaType {
+	if v == nil {
+		return nil
+	}
+	return map[string]OpenAPIMediaType{"application/json": {Schema: g.schema(reflect.TypeOf(v))}}
+}
+
+// schema 返回类型对应的 Schema
+func (g *schemaGenerator) schema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var zero float64
+		return &OpenAPISchema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return &OpenAPISchema{}
+}
+
+// structSchema 返回结构体的 $ref，结构体的 Schema 只生成一次，匿名结构体直接展开
+func (g *schemaGenerator) structSchema(t reflect.Type) *OpenAPISchema {
+	if t.Name() == "" {
+		return g.object(t)
+	}
+	if name, ok := g.names[t]; ok {
+		return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+	}
+	var name = t.Name()
+	if _, taken := g.schemas[name]; taken {
+		name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+	}
+	g.names[t] = name
+	g.schemas[name] = &OpenAPISchema{}
+	*g.schemas[name] = *g.object(t)
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+// object 按 encoding/json 的规则生成结构体字段，没有 omitempty 的非指针字段是必需的
+func (g *schemaGenerator) object(t reflect.Type) *OpenAPISchema {
+	var s = &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	g.fields(s, t)
+	return s
+}
+
+// fields 将结构体字段添加到 s 中，嵌入的结构体字段会展开
+func (g *schemaGenerator) fields(s *OpenAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		var f = t.Field(i)
+		var tag = f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		var name, opts, _ = strings.Cut(tag, ",")
+		var ft = f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(s, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		var fs = g.schema(f.Type)
+		if strings.Contains(","+opts+",", ",string,") {
+			fs = &OpenAPISchema{Type: "string"}
+		}
+		s.Properties[name] = fs
+		if !strings.Contains(","+opts+",", ",omitempty,") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// yamlValue JSON 解码后保留 key 顺序的值
+type yamlValue struct {
+	scalar string
+	keys   []string
+	values []yamlValue
+	object bool
+	array  bool
+}
+
+// decodeYAMLValue 从 JSON token 流中解码一个值
+func decodeYAMLValue(dec *json.Decoder) (yamlValue, error) {
+	var tok, err = dec.Token()
+	if err != nil {
+		return yamlValue{}, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		var v = yamlValue{object: t == '{', array: t == '['}
+		for dec.More() {
+			if v.object {
+				var key json.Token
+				if key, err = dec.Token(); err != nil {
+					return v, err
+				}
+				v.keys = append(v.keys, key.(string))
+			}
+			var item yamlValue
+			if item, err = decodeYAMLValue(dec); err != nil {
+				return v, err
+			}
+			v.values = append(v.values, item)
+		}
+		_, err = dec.Token()
+		return v, err
+	case string:
+		return yamlValue{scalar: yamlString(t)}, nil
+	case json.Number:
+		return yamlValue{scalar: t.String()}, nil
+	case bool:
+		return yamlValue{scalar: strconv.FormatBool(t)}, nil
+	}
+	return yamlValue{scalar: "null"}, nil
+}
+
+// block 是否是非空的对象或数组，需要按块输出
+func (v yamlValue) block() bool {
+	return (v.object || v.array) && len(v.values) > 0
+}
+
+// flow 返回标量或空的对象、数组在一行中的写法
+func (v yamlValue) flow() string {
+	switch {
+	case v.object:
+		return "{}"
+	case v.array:
+		return "[]"
+	}
+	return v.scalar
+}
+
+// writeBlock 以 indent 个空格的缩进输出对象或数组，inline 为 true 时第一行紧跟在 "- " 之后
+func (v yamlValue) writeBlock(buf *bytes.Buffer, indent int, inline bool) {
+	var pad = strings.Repeat(" ", indent)
+	for i, item := range v.values {
+		if i > 0 || !inline {
+			buf.WriteString(pad)
+		}
+		if v.object {
+			buf.WriteString(yamlString(v.keys[i]) + ":")
+			if item.block() {
+				buf.WriteString("\n")
+				item.writeBlock(buf, indent+2, false)
+			} else {
+				buf.WriteString(" " + item.flow() + "\n")
+			}
+			continue
+		}
+		buf.WriteString("- ")
+		if item.block() {
+			item.writeBlock(buf, indent+2, true)
+		} else {
+			buf.WriteString(item.flow() + "\n")
+		}
+	}
+}
+
+// yamlPlain 不需要加引号的 YAML 字符串
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_/$][A-Za-z0-9_./${}-]*$`)
+
+// yamlString 返回 YAML 字符串，可能被误解析的字符串加上引号
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(s)
+	}
+	if yamlPlain.MatchString(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,96 @@
+package seed
+
+import "net/http"
+
+// RouterOption 路由器配置项，在 NewRouter 时传入
+type RouterOption func(o *routerOptions)
+
+// routerOptions 路由器配置
+type routerOptions struct {
+	// caseSensitive 路由字面量分段区分大小写，默认不区分
+	caseSensitive bool
+
+	// useRawPath 使用 URL.RawPath 进行匹配，捕获的参数逐段解码
+	useRawPath bool
+
+	// strictSlash 末尾的 / 是路径的一部分，/a/b/ 与 /a/b 是不同的路由
+	strictSlash bool
+
+	// redirectSlashCode 非 0 时将末尾 / 与重复 / 不规范的请求重定向到注册的路径
+	redirectSlashCode int
+
+	// cleanPathCode 非 0 时将包含 . 、.. 或重复 / 的请求重定向到清理后的路径
+	cleanPathCode int
+}
+
+// WithCaseSensitive 路由匹配区分大小写
+//
+//	默认情况下 /Files/ABC 与 /files/abc 会匹配到同一个路由
+func WithCaseSensitive() RouterOption {
+	return func(o *routerOptions) {
+		o.caseSensitive = true
+	}
+}
+
+// WithRawPath 使用未解码的 URL.RawPath 进行匹配
+//
+//	先按 / 分段再逐段解码，因此分段中的 %2F 不会被当成路径分隔符，捕获的参数值是解码后的值
+func WithRawPath() RouterOption {
+	return func(o *routerOptions) {
+		o.useRawPath = true
+	}
+}
+
+// WithStrictSlash 末尾的 / 作为路径的一部分参与匹配
+//
+//	默认情况下会忽略末尾的 /，/a/b/ 与 /a/b 会匹配到同一个路由
+func WithStrictSlash() RouterOption {
+	return func(o *routerOptions) {
+		o.strictSlash = true
+	}
+}
+
+// WithRedirectSlash 将请求重定向到规范的路径
+//
+//	规范路径中没有重复的 /，末尾是否有 / 与注册的路由一致
+//	配合 WithStrictSlash 使用时，未匹配的请求若增删末尾 / 后可以匹配，也会被重定向
+//	code 为重定向状态码，通常是 301 或 308，为 0 时使用 301
+func WithRedirectSlash(code int) RouterOption {
+	return func(o *routerOptions) {
+		o.redirectSlashCode = redirectCode(code)
+	}
+}
+
+// WithCleanPath 将包含 . 、.. 或重复 / 的请求重定向到清理后的路径
+//
+//	code 为重定向状态码，通常是 301 或 308，为 0 时使用 301
+func WithCleanPath(code int) RouterOption {
+	return func(o *routerOptions) {
+		o.cleanPathCode = redirectCode(code)
+	}
+}
+
+// redirectCode 返回重定向状态码，默认为 301
+func redirectCode(code int) int {
+	if code == 0 {
+		return http.StatusMovedPermanently
+	}
+	return code
+}
+
+// newRouterOptions 应用配置项
+func newRouterOptions(opts ...RouterOption) routerOptions {
+	var o routerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// requestPath 返回用于匹配的请求路径，使用 WithRawPath 时是未解码的路径
+func (o routerOptions) requestPath(req *http.Request) string {
+	if o.useRawPath {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.Path
+}
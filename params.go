@@ -0,0 +1,83 @@
+package seed
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// ParamsCtxKey 路径参数在 context.Context 中的 Key
+var ParamsCtxKey = &ContextKey{Name: "Params"}
+
+// Param 单个路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路由匹配时捕获的路径参数，按在路径中出现的顺序排列
+type Params []Param
+
+// Get 按名称获取路径参数
+func (ps Params) Get(name string) (value string, has bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ParamsFromContext 获取 context 中保存的路径参数
+func ParamsFromContext(ctx context.Context) Params {
+	ps, _ := ctx.Value(ParamsCtxKey).(Params)
+	return ps
+}
+
+// WithParams 将路径参数保存到 context 中
+func WithParams(ctx context.Context, ps Params) context.Context {
+	return context.WithValue(ctx, ParamsCtxKey, ps)
+}
+
+// paramName 解析路由段中的参数名及约束
+//
+//	支持 :name、{name} 与 {name:constraint} 三种写法，匿名的 * 返回空名称
+//	constraint 可以是正则表达式，也可以是内置的类型约束( 详见 paramConstraints )
+func paramName(segment string) (name string, constraint string, ok bool) {
+	switch {
+	case segment == "*":
+		return "", "", true
+	case len(segment) > 1 && segment[0] == ':':
+		return segment[1:], "", true
+	case len(segment) > 2 && segment[0] == '{' && segment[len(segment)-1] == '}':
+		name = segment[1 : len(segment)-1]
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, constraint = name[:i], name[i+1:]
+		}
+		return name, constraint, true
+	}
+	return "", "", false
+}
+
+// paramConstraints 内置的路径参数类型约束
+var paramConstraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"alpha": `[a-zA-Z]+`,
+}
+
+// compileConstraint 编译路径参数约束，约束需要匹配整个路由段
+func compileConstraint(constraint string) (*regexp.Regexp, error) {
+	if expr, ok := paramConstraints[constraint]; ok {
+		constraint = expr
+	}
+	return regexp.Compile("^(?:" + constraint + ")$")
+}
+
+// catchAllName 解析末尾通配段 *name 中的参数名
+func catchAllName(segment string) (name string, ok bool) {
+	if len(segment) > 1 && segment[0] == '*' {
+		return segment[1:], true
+	}
+	return "", false
+}
@@ -0,0 +1,611 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// radixMapper 基于压缩前缀树的路由匹配器，NewRouter 默认使用
+//
+// 查找时直接在规范化后的 path 上逐字节匹配，不对 path 分段，ASCII 字母逐字节忽略大小写，
+// 静态路由与参数路由的查找不会分配内存(path 中包含重复的 /、不区分大小写时包含非 ASCII 字符或 WithRawPath 下参数值需要解码时除外)
+type radixMapper struct {
+	roots   map[string]*radixNode
+	hosts   []*radixHost
+	routes  []Route
+	options routerOptions
+}
+
+// radixHost 限定 host 的路由树
+type radixHost struct {
+	*hostPattern
+	roots map[string]*radixNode
+}
+
+// radixNode 压缩前缀树节点
+//
+// 静态子节点按首字节索引，参数类子节点只会出现在分段边界(prefix 以 / 结尾的节点或根节点)上
+// 同一分段的匹配优先级为: 字面量 > 带约束的参数(按注册顺序) > 参数 > 末尾通配
+type radixNode struct {
+	prefix  string
+	indices string
+	statics []*radixNode
+
+	constraints []*radixNode
+	param       *radixNode
+	catchAll    *radixNode
+	leaves      routeLeaves
+
+	// constraint 带约束的参数节点的约束表达式及其编译结果
+	constraint string
+	regexp     *regexp.Regexp
+}
+
+// radixToken 路由 pattern 解析后的片段
+type radixToken struct {
+	static     string
+	param      bool
+	catchAll   bool
+	constraint string
+}
+
+// radixContext 一次查找过程的状态
+type radixContext struct {
+	matchContext
+
+	ps       Params
+	fold     bool
+	unescape bool
+
+	// source 不区分大小写且 path 包含非 ASCII 字符时，转为小写前的 path，参数值从中截取
+	source string
+}
+
+// newRadixMapper 返回 radixMapper 实例
+func newRadixMapper(options routerOptions) *radixMapper {
+	return &radixMapper{roots: map[string]*radixNode{}, options: options}
+}
+
+// Find 实现 RouteMapper
+//
+// 依次匹配不含参数的 host、含参数的 host 以及不限 host 的路由
+func (rm *radixMapper) Find(req *http.Request, ps Params) (Route, Params, error) {
+	var p = rm.normalize(rm.options.requestPath(req))
+	var rc = radixContext{
+		matchContext: matchContext{req: req},
+		ps:           ps,
+		fold:         !rm.options.caseSensitive,
+		unescape:     rm.options.useRawPath,
+	}
+	p = rc.foldPath(p)
+	var base = len(ps)
+	if len(rm.hosts) > 0 {
+		var host = requestHost(req)
+		for _, rh := range rm.hosts {
+			var ok bool
+			if rc.ps, ok = rh.match(host, rc.ps[:base]); !ok {
+				continue
+			}
+			if root, has := rh.roots[req.Method]; has {
+				var n = len(rc.ps)
+				if leaf := root.match(&rc, p); leaf != nil {
+					return leaf.route, rc.name(leaf, n), nil
+				}
+			}
+		}
+		rc.ps = rc.ps[:base]
+	}
+	if root, has := rm.roots[req.Method]; has {
+		if leaf := root.match(&rc, p); leaf != nil {
+			return leaf.route, rc.name(leaf, base), nil
+		}
+	}
+	if rc.status != 0 {
+		return nil, rc.ps[:base], &MatchError{Status: rc.status}
+	}
+	return nil, rc.ps[:base], nil
+}
+
+// Allowed 实现 RouteMapper
+func (rm *radixMapper) Allowed(req *http.Request) []string {
+	var p = rm.normalize(rm.options.requestPath(req))
+	var host = requestHost(req)
+	var allowed []string
+	var base = radixContext{fold: !rm.options.caseSensitive, unescape: rm.options.useRawPath}
+	p = base.foldPath(p)
+	for _, method := range httpMethods {
+		var rc = base
+		var found = false
+		for _, rh := range rm.hosts {
+			if _, ok := rh.match(host, nil); ok && rh.roots[method] != nil {
+				found = rh.roots[method].match(&rc, p) != nil
+			}
+			if found {
+				break
+			}
+		}
+		if !found && rm.roots[method] != nil {
+			found = rm.roots[method].match(&rc, p) != nil
+		}
+		if found {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// Routes 实现 RouteMapper
+func (rm *radixMapper) Routes() []Route {
+	var routes = make([]Route, len(rm.routes))
+	_ = copy(routes, rm.routes)
+	return routes
+}
+
+// Add 实现 RouteMapper
+func (rm *radixMapper) Add(route Route) error {
+	var node, names, err = rm.node(route, true)
+	if err != nil {
+		return err
+	}
+	if node.leaves.add(&routeLeaf{route: route, names: names}) {
+		rm.routes = append(rm.routes, route)
+		return nil
+	}
+	if route.Host() != "" {
+		return fmt.Errorf("conflict route host: %s method: %s path: %s ", route.Host(), route.Method(), route.Path())
+	}
+	return fmt.Errorf("conflict route method: %s path: %s ", route.Method(), route.Path())
+}
+
+// Remove 实现 RouteMapper
+func (rm *radixMapper) Remove(route Route) bool {
+	var node, _, err = rm.node(route, false)
+	if err != nil || node == nil {
+		return false
+	}
+	var i = slices.IndexFunc(node.leaves, func(leaf *routeLeaf) bool { return leaf.route == route })
+	if i < 0 {
+		return false
+	}
+	node.leaves = slices.Delete(node.leaves, i, i+1)
+	rm.routes = slices.DeleteFunc(slices.Clone(rm.routes), func(r Route) bool { return r == route })
+	return true
+}
+
+// replace 将路由 old 替换为 new，两者的 method、host 及 path 相同，注册顺序不变
+func (rm *radixMapper) replace(old, new Route) bool {
+	var node, _, err = rm.node(old, false)
+	if err != nil || node == nil {
+		return false
+	}
+	var i = slices.IndexFunc(node.leaves, func(leaf *routeLeaf) bool { return leaf.route == old })
+	if i < 0 {
+		return false
+	}
+	node.leaves[i] = &routeLeaf{route: new, names: node.leaves[i].names}
+	rm.routes = slices.Clone(rm.routes)
+	rm.routes[slices.Index(rm.routes, old)] = new
+	return true
+}
+
+// Clone 实现 RouteMapper
+//
+// 副本与原匹配器共享路由树的节点，Add、Remove 只复制修改路径上的节点，开销与路由数量无关
+func (rm *radixMapper) Clone() RouteMapper {
+	var c = &radixMapper{roots: maps.Clone(rm.roots), routes: slices.Clip(rm.routes), options: rm.options}
+	for _, rh := range rm.hosts {
+		c.hosts = append(c.hosts, &radixHost{hostPattern: rh.hostPattern, roots: maps.Clone(rh.roots)})
+	}
+	return c
+}
+
+// node 返回路由所在的节点及路由中声明的参数名，从根节点到该节点路径上的节点都会被复制
+//
+// create 为 false 时不新建节点，节点不存在时返回 nil
+func (rm *radixMapper) node(route Route, create bool) (*radixNode, []string, error) {
+	var tokens, names, err = rm.tokenize(route.Path())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v method: %s path: %s ", err, route.Method(), route.Path())
+	}
+
+	var roots = rm.roots
+	if route.Host() != "" {
+		var rh *radixHost
+		if rh, err = rm.hostFor(route.Host(), create); rh == nil {
+			return nil, nil, err
+		}
+		roots = rh.roots
+	}
+	if roots[route.Method()] == nil && !create {
+		return nil, nil, nil
+	}
+	var node = roots[route.Method()].clone()
+	roots[route.Method()] = node
+
+	for _, token := range tokens {
+		switch {
+		case token.catchAll:
+			node = copyChild(&node.catchAll, create)
+		case token.constraint != "":
+			if node, err = node.constraintChild(token.constraint, create); err != nil {
+				return nil, nil, fmt.Errorf("invalid route constraint method: %s path: %s err: %v", route.Method(), route.Path(), err)
+			}
+		case token.param:
+			node = copyChild(&node.param, create)
+		default:
+			node = node.staticChildPath(token.static, create)
+		}
+		if node == nil {
+			return nil, nil, nil
+		}
+	}
+	return node, names, nil
+}
+
+// hostFor 返回 pattern 对应的路由树，create 为 true 时不存在则新建
+func (rm *radixMapper) hostFor(pattern string, create bool) (*radixHost, error) {
+	for _, rh := range rm.hosts {
+		if rh.pattern == strings.ToLower(pattern) {
+			return rh, nil
+		}
+	}
+	if !create {
+		return nil, nil
+	}
+	var hp, err = newHostPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var rh = &radixHost{hostPattern: hp, roots: map[string]*radixNode{}}
+	var i = hostInsertIndex(hp, len(rm.hosts), func(i int) bool { return rm.hosts[i].params })
+	rm.hosts = slices.Insert(slices.Clip(rm.hosts), i, rh)
+	return rh, nil
+}
+
+// normalize 规范化路径: 合并重复的 /，去掉开头的 /，未使用 WithStrictSlash 时去掉末尾的 /
+func (rm *radixMapper) normalize(p string) string {
+	if strings.Contains(p, "//") {
+		p = rexp.ReplaceAllString(p, "/")
+	}
+	p = strings.TrimPrefix(p, "/")
+	if !rm.options.strictSlash {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// tokenize 将路由 pattern 解析为静态片段与参数片段
+//
+// 静态片段不区分大小写时按 foldString 转为小写，使用 WithRawPath 时按 URL.EscapedPath 的规则转义
+func (rm *radixMapper) tokenize(pattern string) ([]radixToken, []string, error) {
+	var segments = strings.Split(rm.normalize(pattern), "/")
+	var tokens []radixToken
+	var names []string
+	var static strings.Builder
+	var flush = func() {
+		if static.Len() > 0 {
+			tokens = append(tokens, radixToken{static: static.String()})
+			static.Reset()
+		}
+	}
+
+	for i, segment := range segments {
+		if i > 0 {
+			static.WriteByte('/')
+		}
+		if name, isCatchAll := catchAllName(segment); isCatchAll {
+			if i != len(segments)-1 {
+				return nil, nil, errors.New("catch-all segment must be the last,")
+			}
+			flush()
+			tokens = append(tokens, radixToken{catchAll: true})
+			names = append(names, name)
+			continue
+		}
+		if name, constraint, isParam := paramName(segment); isParam {
+			flush()
+			tokens = append(tokens, radixToken{param: true, constraint: constraint})
+			names = append(names, name)
+			continue
+		}
+		static.WriteString(rm.literal(segment))
+	}
+	flush()
+	return tokens, names, nil
+}
+
+// literal 返回字面量分段在路由树中的形式
+func (rm *radixMapper) literal(segment string) string {
+	if rm.options.useRawPath {
+		segment = (&url.URL{Path: segment}).EscapedPath()
+	}
+	if !rm.options.caseSensitive {
+		segment = foldString(segment)
+	}
+	return segment
+}
+
+// match 深度优先匹配剩余的 path，子树匹配失败时回溯到下一个候选
+func (n *radixNode) match(rc *radixContext, p string) *routeLeaf {
+	if p == "" {
+		if leaf := n.accept(rc); leaf != nil {
+			return leaf
+		}
+		if leaf := n.catchAllLeaf(rc, ""); leaf != nil {
+			return leaf
+		}
+	}
+
+	var c byte = '/'
+	if p != "" {
+		c = lowerByte(p[0], rc.fold)
+	}
+	if child := n.staticChild(c); child != nil {
+		if hasPrefix(p, child.prefix, rc.fold) {
+			if leaf := child.match(rc, p[len(child.prefix):]); leaf != nil {
+				return leaf
+			}
+		} else if len(child.prefix) == len(p)+1 && child.prefix[len(p)] == '/' && hasPrefix(p, child.prefix[:len(p)], rc.fold) {
+			// 末尾通配匹配空路径，如 /static/*filepath 匹配 /static
+			if leaf := child.catchAllLeaf(rc, ""); leaf != nil {
+				return leaf
+			}
+		}
+	}
+
+	if n.constraints == nil && n.param == nil && n.catchAll == nil {
+		return nil
+	}
+	var end = strings.IndexByte(p, '/')
+	if end < 0 {
+		end = len(p)
+	}
+	if end > 0 {
+		var segment = rc.original(p, end)
+		for _, child := range n.constraints {
+			if child.regexp.MatchString(rc.value(segment)) {
+				if leaf := rc.capture(child, segment, p[end:]); leaf != nil {
+					return leaf
+				}
+			}
+		}
+		if n.param != nil {
+			if leaf := rc.capture(n.param, segment, p[end:]); leaf != nil {
+				return leaf
+			}
+		}
+	}
+	if p != "" {
+		return n.catchAllLeaf(rc, p)
+	}
+	return nil
+}
+
+// catchAllLeaf 用末尾通配匹配剩余的 path
+func (n *radixNode) catchAllLeaf(rc *radixContext, rest string) *routeLeaf {
+	if n.catchAll == nil {
+		return nil
+	}
+	if leaf := n.catchAll.accept(rc); leaf != nil {
+		rc.ps = append(rc.ps, Param{Value: rc.value(rc.original(rest, len(rest)))})
+		return leaf
+	}
+	return nil
+}
+
+// accept 返回节点上第一个满足全部 Matcher 的路由
+func (n *radixNode) accept(rc *radixContext) *routeLeaf {
+	return n.leaves.accept(&rc.matchContext)
+}
+
+// staticChild 返回首字节为 c 的静态子节点
+func (n *radixNode) staticChild(c byte) *radixNode {
+	if i := strings.IndexByte(n.indices, c); i >= 0 {
+		return n.statics[i]
+	}
+	return nil
+}
+
+// staticChildPath 返回静态片段末尾对应的节点，路径上的节点都会被复制
+//
+// create 为 true 时不存在则插入，必要时拆分已有节点；为 false 时不存在返回 nil
+func (n *radixNode) staticChildPath(s string, create bool) *radixNode {
+	for len(s) > 0 {
+		var i = strings.IndexByte(n.indices, s[0])
+		if i < 0 {
+			if !create {
+				return nil
+			}
+			var child = &radixNode{prefix: s}
+			n.indices += s[:1]
+			n.statics = append(n.statics, child)
+			return child
+		}
+
+		var child = n.statics[i].clone()
+		n.statics[i] = child
+		var common = 0
+		for common < len(s) && common < len(child.prefix) && s[common] == child.prefix[common] {
+			common++
+		}
+		if common < len(child.prefix) {
+			if !create {
+				return nil
+			}
+			// 拆分节点: child 保留公共前缀，原有内容移到新的子节点
+			var tail = *child
+			tail.prefix = child.prefix[common:]
+			*child = radixNode{prefix: child.prefix[:common], indices: tail.prefix[:1], statics: []*radixNode{&tail}}
+		}
+		n, s = child, s[common:]
+	}
+	return n
+}
+
+// constraintChild 返回约束相同的子节点的副本，create 为 true 时不存在则编译约束并新建
+func (n *radixNode) constraintChild(constraint string, create bool) (*radixNode, error) {
+	for i, child := range n.constraints {
+		if child.constraint == constraint {
+			n.constraints[i] = child.clone()
+			return n.constraints[i], nil
+		}
+	}
+	if !create {
+		return nil, nil
+	}
+	var exp, err = compileConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	var child = &radixNode{constraint: constraint, regexp: exp}
+	n.constraints = append(n.constraints, child)
+	return child, nil
+}
+
+// clone 复制节点，子节点仍然共享，n 为 nil 时返回新节点
+func (n *radixNode) clone() *radixNode {
+	if n == nil {
+		return &radixNode{}
+	}
+	var c = *n
+	c.statics = slices.Clone(n.statics)
+	c.constraints = slices.Clone(n.constraints)
+	c.leaves = slices.Clone(n.leaves)
+	return &c
+}
+
+// copyChild 将 slot 指向的子节点替换为副本，create 为 true 时不存在则新建
+func copyChild(slot **radixNode, create bool) *radixNode {
+	if *slot == nil && !create {
+		return nil
+	}
+	*slot = (*slot).clone()
+	return *slot
+}
+
+// capture 捕获参数值后继续匹配，失败时撤销捕获
+func (rc *radixContext) capture(child *radixNode, segment string, rest string) *routeLeaf {
+	var n = len(rc.ps)
+	rc.ps = append(rc.ps, Param{Value: rc.value(segment)})
+	if leaf := child.match(rc, rest); leaf != nil {
+		return leaf
+	}
+	rc.ps = rc.ps[:n]
+	return nil
+}
+
+// foldPath 不区分大小写且 p 包含非 ASCII 字符时返回转为小写的 p，并记录原始的 p
+//
+// 只包含 ASCII 字符时由 hasPrefix 逐字节忽略大小写，不需要转换
+func (rc *radixContext) foldPath(p string) string {
+	if !rc.fold || isASCII(p) {
+		return p
+	}
+	rc.source = p
+	return foldString(p)
+}
+
+// original 返回剩余 path p 的前 n 个字节在原始 path 中对应的内容
+//
+// foldString 不改变字节长度，因此剩余 path 在两者中的位置相同
+func (rc *radixContext) original(p string, n int) string {
+	if rc.source == "" {
+		return p[:n]
+	}
+	var offset = len(rc.source) - len(p)
+	return rc.source[offset : offset+n]
+}
+
+// value 返回参数值，使用 WithRawPath 时解码
+func (rc *radixContext) value(s string) string {
+	if rc.unescape && strings.IndexByte(s, '%') >= 0 {
+		if v, err := url.PathUnescape(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+// name 为 base 之后捕获的路径参数设置参数名，并去掉匿名参数
+//
+// 路径参数按在 path 中出现的顺序追加，与路由中声明的顺序一致
+func (rc *radixContext) name(leaf *routeLeaf, base int) Params {
+	var ps = rc.ps
+	var j = base
+	for i := base; i < len(ps) && i-base < len(leaf.names); i++ {
+		if leaf.names[i-base] == "" {
+			continue
+		}
+		ps[j] = Param{Key: leaf.names[i-base], Value: ps[i].Value}
+		j++
+	}
+	return ps[:j]
+}
+
+// hasPrefix 判断 s 是否以 prefix 开头，fold 时忽略 ASCII 字母大小写(prefix 已是小写)
+func hasPrefix(s, prefix string, fold bool) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	if !fold {
+		return s[:len(prefix)] == prefix
+	}
+	for i := 0; i < len(prefix); i++ {
+		if lowerByte(s[i], true) != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lowerByte 将 ASCII 大写字母转为小写
+func lowerByte(c byte, fold bool) byte {
+	if fold && 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// foldString 将字符串转为小写，用于不区分大小写的匹配
+//
+// 非 ASCII 字符按 unicode.ToLower 转换，转换后 UTF-8 编码长度不同的字符(如 İ、K)保持不变，
+// 这样转换前后的字节位置一一对应，可以从原始 path 中截取参数值
+func foldString(s string) string {
+	if isASCII(s) {
+		var bs = []byte(s)
+		for i := range bs {
+			bs[i] = lowerByte(bs[i], true)
+		}
+		return string(bs)
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		var r, size = utf8.DecodeRuneInString(s[i:])
+		if lower := unicode.ToLower(r); r != utf8.RuneError && utf8.RuneLen(lower) == size {
+			b.WriteRune(lower)
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// isASCII 判断字符串是否只包含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
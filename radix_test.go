@@ -0,0 +1,369 @@
+package seed
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// benchMapper 两种路由匹配器共同的方法
+type benchMapper interface {
+	Add(route Route) error
+	Find(req *http.Request, ps Params) (Route, Params, error)
+}
+
+// benchRoutes 用于对比两种 RouteMapper 的路由表
+var benchRoutes = []string{
+	"/",
+	"/user",
+	"/user/:id",
+	"/user/:id/orders",
+	"/user/:id/orders/{oid:int}",
+	"/users/search",
+	"/order/{id:int}",
+	"/order/:id/items/:item",
+	"/static/*filepath",
+}
+
+// newBenchMappers 返回注册了 benchRoutes 的两种路由匹配器
+func newBenchMappers(tb testing.TB) map[string]benchMapper {
+	var mappers = map[string]benchMapper{
+		"radix": newRadixMapper(routerOptions{}),
+		"map":   &routeMapper{tree: map[string]*routeNode{}},
+	}
+	var routes = append([]string{}, benchRoutes...)
+	for i := 0; i < 50; i++ {
+		routes = append(routes, fmt.Sprintf("/api/v1/resource%d/:id", i))
+	}
+	for _, rm := range mappers {
+		for _, p := range routes {
+			if err := rm.Add(&route{method: MethodGet, path: p}); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return mappers
+}
+
+func TestRadixMapperAllocs(t *testing.T) {
+	var rm = newBenchMappers(t)["radix"]
+	var ps = make(Params, 0, 8)
+	for _, p := range []string{"/user", "/users/search", "/user/42/orders/7", "/api/v1/resource42/7", "/static/js/app.js"} {
+		var req = httptest.NewRequest(MethodGet, p, nil)
+		if r, _, _ := rm.Find(req, ps); r == nil {
+			t.Fatalf("%s not matched", p)
+		}
+		if allocs := testing.AllocsPerRun(100, func() { _, _, _ = rm.Find(req, ps) }); allocs != 0 {
+			t.Errorf("%s: want 0 allocs, got %v", p, allocs)
+		}
+	}
+}
+
+func TestRadixMapperUnicodeFold(t *testing.T) {
+	var fold, exact = newRadixMapper(routerOptions{}), newRadixMapper(routerOptions{caseSensitive: true})
+	for _, rm := range []*radixMapper{fold, exact} {
+		for _, p := range []string{"/Ünïcode", "/ü/:name", "/Straße/*rest"} {
+			if err := rm.Add(&route{method: MethodGet, path: p}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var cases = []struct {
+		path, want, param string
+	}{
+		{"/ünïcode", "/Ünïcode", ""},
+		{"/ÜNÏCODE", "/Ünïcode", ""},
+		{"/Ü/Jörg", "/ü/:name", "Jörg"},
+		{"/Ü/\xffÄ", "/ü/:name", "\xffÄ"},
+		{"/STRASSE/x", "", ""},
+		{"/straße/Äb/C", "/Straße/*rest", "Äb/C"},
+	}
+	for _, c := range cases {
+		var req = httptest.NewRequest(MethodGet, "/", nil)
+		req.URL.Path = c.path
+		var route, ps, _ = fold.Find(req, nil)
+		var got, param = "", ""
+		if route != nil {
+			got = route.Path()
+		}
+		if len(ps) > 0 {
+			param = ps[0].Value
+		}
+		if got != c.want || param != c.param {
+			t.Errorf("%s: want %q %q, got %q %q", c.path, c.want, c.param, got, param)
+		}
+	}
+	var req = httptest.NewRequest(MethodGet, "/", nil)
+	req.URL.Path = "/ünïcode"
+	if route, _, _ := exact.Find(req, nil); route != nil {
+		t.Fatalf("want no match with WithCaseSensitive, got %s", route.Path())
+	}
+}
+
+func TestRadixMapperClone(t *testing.T) {
+	var rm = newRadixMapper(routerOptions{})
+	var user = &route{method: MethodGet, path: "/user/:id"}
+	_ = rm.Add(user)
+	_ = rm.Add(&route{method: MethodGet, path: "/users", host: "api.example.com"})
+
+	var c = rm.Clone()
+	_ = c.Add(&route{method: MethodGet, path: "/user/me"})
+	_ = c.Add(&route{method: MethodGet, path: "/us", host: "api.example.com"})
+	if !c.Remove(user) || c.Remove(user) {
+		t.Fatal("remove must report whether the route existed")
+	}
+
+	for p, want := range map[string]string{"/user/me": "/user/:id", "/user/1": "/user/:id", "/us": ""} {
+		var req = httptest.NewRequest(MethodGet, "http://api.example.com"+p, nil)
+		var got string
+		if r, _, _ := rm.Find(req, nil); r != nil {
+			got = r.Path()
+		}
+		if got != want {
+			t.Errorf("original %s: want %q, got %q", p, want, got)
+		}
+	}
+	for p, want := range map[string]string{"/user/me": "/user/me", "/user/1": "", "/us": "/us", "/users": "/users"} {
+		var req = httptest.NewRequest(MethodGet, "http://api.example.com"+p, nil)
+		var got string
+		if r, _, _ := c.Find(req, nil); r != nil {
+			got = r.Path()
+		}
+		if got != want {
+			t.Errorf("clone %s: want %q, got %q", p, want, got)
+		}
+	}
+	if len(rm.Routes()) != 2 || len(c.Routes()) != 3 {
+		t.Fatalf("want 2 and 3 routes, got %d %d", len(rm.Routes()), len(c.Routes()))
+	}
+}
+
+func BenchmarkRouteMapper(b *testing.B) {
+	var mappers = newBenchMappers(b)
+	var paths = map[string]string{
+		"static": "/users/search",
+		"param":  "/user/42/orders/7",
+		"wide":   "/api/v1/resource42/7",
+		"catch":  "/static/js/app.js",
+	}
+	for _, kind := range []string{"static", "param", "wide", "catch"} {
+		for _, name := range []string{"radix", "map"} {
+			var rm = mappers[name]
+			var req = httptest.NewRequest(http.MethodGet, paths[kind], nil)
+			b.Run(kind+"/"+name, func(b *testing.B) {
+				var ps = make(Params, 0, 8)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _, _ = rm.Find(req, ps[:0])
+				}
+			})
+		}
+	}
+}
+
+// routeNode 路由匹配器节点
+//
+// 同一分段的匹配优先级为: 字面量 > 带约束的参数(按注册顺序) > 参数 > 末尾通配
+type routeNode struct {
+	leaves      routeLeaves
+	children    map[string]*routeNode
+	constraints []*routeNode
+	param       *routeNode
+	catchAll    *routeNode
+
+	// constraint 带约束的参数节点的约束表达式及其编译结果
+	constraint string
+	regexp     *regexp.Regexp
+}
+
+// routeMapper 原先按分段逐层匹配的路由匹配器，只保留 Add 与 Find，作为 radixMapper 的对照
+//
+// 每次查找都需要对 path 分段，不支持 host
+type routeMapper struct {
+	tree    map[string]*routeNode
+	options routerOptions
+}
+
+// Find 查找请求匹配的路由
+func (rm *routeMapper) Find(req *http.Request, ps Params) (Route, Params, error) {
+	var segments, keys = rm.requestSegments(req)
+	var mc = &matchContext{req: req}
+	if node, ok := rm.tree[req.Method]; ok {
+		if matched, values := node.match(mc, keys, segments, nil); matched != nil {
+			return matched.route, append(ps, matched.params(values)...), nil
+		}
+	}
+	if mc.status != 0 {
+		return nil, ps, &MatchError{Status: mc.status}
+	}
+	return nil, ps, nil
+}
+
+// Add 添加路由
+func (rm *routeMapper) Add(route Route) error {
+	var segments = rm.segment(route.Path())
+	var tree = rm.tree
+	var node, ok = tree[route.Method()]
+	if !ok {
+		node = &routeNode{children: make(map[string]*routeNode)}
+		tree[route.Method()] = node
+	}
+
+	var names []string
+	for i, segment := range segments {
+		if name, isCatchAll := catchAllName(segment); isCatchAll {
+			if i != len(segments)-1 {
+				return fmt.Errorf("catch-all segment must be the last, method: %s path: %s ", route.Method(), route.Path())
+			}
+			names = append(names, name)
+			if node.catchAll == nil {
+				node.catchAll = &routeNode{children: make(map[string]*routeNode)}
+			}
+			node = node.catchAll
+			break
+		}
+		if name, constraint, isParam := paramName(segment); isParam {
+			names = append(names, name)
+			if constraint != "" {
+				var child, err = node.constraintChild(constraint)
+				if err != nil {
+					return fmt.Errorf("invalid route constraint method: %s path: %s err: %v", route.Method(), route.Path(), err)
+				}
+				node = child
+				continue
+			}
+			if node.param == nil {
+				node.param = &routeNode{children: make(map[string]*routeNode)}
+			}
+			node = node.param
+			continue
+		}
+		if !rm.options.caseSensitive {
+			segment = strings.ToLower(segment)
+		}
+		if child, ok := node.children[segment]; ok {
+			node = child
+			continue
+		}
+		var newNode = &routeNode{children: make(map[string]*routeNode)}
+		node.children[segment] = newNode
+		node = newNode
+	}
+
+	if node.leaves.add(&routeLeaf{route: route, names: names}) {
+		return nil
+	}
+	return fmt.Errorf("conflict route method: %s path: %s ", route.Method(), route.Path())
+}
+
+// match 深度优先匹配剩余的分段，按优先级依次尝试子节点，子树匹配失败时回溯到下一个候选
+//
+// keys 是用于匹配字面量的分段，segments 是用于约束校验及参数捕获的原始分段
+func (n *routeNode) match(mc *matchContext, keys []string, segments []string, values []string) (*routeLeaf, []string) {
+	if len(segments) == 0 {
+		if leaf := n.leaves.accept(mc); leaf != nil {
+			return leaf, values
+		}
+		if n.catchAll != nil {
+			if leaf := n.catchAll.leaves.accept(mc); leaf != nil {
+				return leaf, append(values, "")
+			}
+		}
+		return nil, nil
+	}
+
+	var segment = segments[0]
+	if child, ok := n.children[keys[0]]; ok {
+		if matched, vs := child.match(mc, keys[1:], segments[1:], values); matched != nil {
+			return matched, vs
+		}
+	}
+	for _, child := range n.constraints {
+		if segment == "" || !child.regexp.MatchString(segment) {
+			continue
+		}
+		if matched, vs := child.match(mc, keys[1:], segments[1:], append(values, segment)); matched != nil {
+			return matched, vs
+		}
+	}
+	if n.param != nil && segment != "" {
+		if matched, vs := n.param.match(mc, keys[1:], segments[1:], append(values, segment)); matched != nil {
+			return matched, vs
+		}
+	}
+	if n.catchAll != nil {
+		if leaf := n.catchAll.leaves.accept(mc); leaf != nil {
+			return leaf, append(values, strings.Join(segments, "/"))
+		}
+	}
+	return nil, nil
+}
+
+// constraintChild 返回约束相同的子节点，不存在时编译约束并新建
+func (n *routeNode) constraintChild(constraint string) (*routeNode, error) {
+	for _, child := range n.constraints {
+		if child.constraint == constraint {
+			return child, nil
+		}
+	}
+	var exp, err = compileConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	var child = &routeNode{children: make(map[string]*routeNode), constraint: constraint, regexp: exp}
+	n.constraints = append(n.constraints, child)
+	return child, nil
+}
+
+// params 将捕获的参数值与路由中声明的参数名对应起来，匿名的 * 不会被保存
+func (l *routeLeaf) params(values []string) Params {
+	var ps Params
+	for i, name := range l.names {
+		if name != "" && i < len(values) {
+			ps = append(ps, Param{Key: name, Value: values[i]})
+		}
+	}
+	return ps
+}
+
+// segment 对路由path进行分段，根路径没有分段
+//
+// 使用 WithStrictSlash 时末尾的 / 会产生一个空的分段
+func (rm *routeMapper) segment(p string) []string {
+	var trailingSlash = rm.options.strictSlash && len(p) > 1 && strings.HasSuffix(p, "/")
+	p = rexp.ReplaceAllString(strings.Trim(p, "/"), "/")
+	if p == "/" || p == "" {
+		return nil
+	}
+	var segments = strings.Split(p, "/")
+	if trailingSlash {
+		segments = append(segments, "")
+	}
+	return segments
+}
+
+// requestSegments 返回请求路径的原始分段及用于匹配字面量的分段
+func (rm *routeMapper) requestSegments(req *http.Request) (segments []string, keys []string) {
+	if !rm.options.useRawPath {
+		segments = rm.segment(req.URL.Path)
+	} else {
+		segments = rm.segment(req.URL.EscapedPath())
+		for i, segment := range segments {
+			if v, err := url.PathUnescape(segment); err == nil {
+				segments[i] = v
+			}
+		}
+	}
+	if rm.options.caseSensitive {
+		return segments, segments
+	}
+	keys = make([]string, len(segments))
+	for i, segment := range segments {
+		keys[i] = strings.ToLower(segment)
+	}
+	return segments, keys
+}
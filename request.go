@@ -29,6 +29,12 @@ type Request interface {
 	// ParamDefault 获取GET/POST方式传递的参数如果没有那么返回默认值/空值
 	ParamDefault(name string, defaultValue ...string) (value string)
 
+	// PathParam 获取路由路径中的命名参数，如 "/user/:id" 中的 id
+	PathParam(name string) (value string, has bool)
+
+	// PathParamDefault 获取路由路径中的命名参数如果没有那么返回默认值/空值
+	PathParamDefault(name string, defaultValue ...string) (value string)
+
 	// Header 获取Header传递的参数
 	Header(name string) (value string, has bool)
 
@@ -117,6 +123,21 @@ func (r *request) ParamDefault(name string, defaultValue ...string) (value strin
 	return v
 }
 
+func (r *request) PathParam(name string) (value string, has bool) {
+	return ParamsFromContext(r.Context()).Get(name)
+}
+
+func (r *request) PathParamDefault(name string, defaultValue ...string) (value string) {
+	var v string
+	if v, has := r.PathParam(name); has {
+		return v
+	}
+	if len(defaultValue) > 0 {
+		v = defaultValue[0]
+	}
+	return v
+}
+
 func (r *request) Header(name string) (value string, has bool) {
 	var vs = r.Request.Header.Values(name)
 	if len(vs) == 0 {
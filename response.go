@@ -12,6 +12,9 @@ const (
 
 	// HeaderContentLength HTTP Header 中 Content-Length 的 Key
 	HeaderContentLength = "Content-Length"
+
+	// HeaderAllow HTTP Header 中 Allow 的 Key
+	HeaderAllow = "Allow"
 )
 
 type Response interface {
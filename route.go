@@ -1,19 +1,96 @@
 package seed
 
-import "net/http"
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync/atomic"
+)
+
+// RouteCtxKey 匹配到的路由在 context.Context 中的 Key
+var RouteCtxKey = &ContextKey{Name: "Route"}
 
 type Route interface {
 	http.Handler
 
 	Path() string
 	Method() string
+	Name() string
+
+	// Host 返回路由限定的 host pattern，不限 host 时为空
+	Host() string
+
+	// Matchers 返回路由的附加匹配条件
+	Matchers() []Matcher
+
+	// Middlewares 返回路由生效的中间件数量，包括 Use、Group 以及注册时传入的中间件
+	Middlewares() int
+
+	// Disabled 返回路由是否已停用
+	Disabled() bool
+
+	// Meta 按 key 获取注册时设置的元数据
+	Meta(key string) (value any, has bool)
+
+	// Metadata 返回全部元数据的副本
+	Metadata() map[string]any
+}
+
+// RouteSetter 用于设置注册后路由的属性
+//
+//	以逗号连接多个方法注册时，设置会作用于所有方法的路由
+type RouteSetter interface {
+	// Name 设置路由名称，可用于 Router.URL 反向生成 URL，名称不能重复，重复时 panic
+	Name(name string) RouteSetter
+
+	// TryName 与 Name 相同，名称重复时返回 error 而不是 panic，不修改路由名称
+	TryName(name string) error
+
+	// Meta 设置路由的元数据，中间件可以通过 RouteFromContext 获取路由后读取
+	//
+	// 	如 r.HandleFunc("DELETE", "/user/:id", h).Meta("scope", "user:write")
+	Meta(key string, value any) RouteSetter
+
+	// Operation 设置路由的 OpenAPI 描述，用于 NewOpenAPI 及 Router.OpenAPI 生成文档
+	Operation(op Operation) RouteSetter
+
+	// Skip 路由不执行以 Named 命名的中间件，包括 Use 及 Group 继承的中间件
+	//
+	// 	如 r.HandleFunc("GET", "/health", h).Skip("logger")
+	Skip(names ...string) RouteSetter
+
+	// Disable 停用路由，停用后请求按未注册该路由处理，可以随时通过 Enable 恢复
+	//
+	// 	可用于功能开关，运行中调用是并发安全的
+	Disable() RouteSetter
+
+	// Enable 恢复已停用的路由
+	Enable() RouteSetter
+
+	// Remove 从路由表中删除路由，运行中调用是并发安全的
+	Remove()
 }
 
 type route struct {
 	http.Handler
 
-	path   string
-	method string
+	path        string
+	host        string
+	method      string
+	name        string
+	middlewares int
+	matchers    []Matcher
+	segments    []patternSegment
+	options     routerOptions
+	disabled    atomic.Bool
+	meta        atomic.Pointer[map[string]any]
+}
+
+// routeSetter 实现 RouteSetter
+type routeSetter struct {
+	router *router
+	routes []*route
 }
 
 // Path 返回当前请求的path
@@ -25,3 +102,162 @@ func (r *route) Path() string {
 func (r *route) Method() string {
 	return r.method
 }
+
+// Host 返回路由限定的 host pattern
+func (r *route) Host() string {
+	return r.host
+}
+
+// Matchers 返回路由的附加匹配条件
+func (r *route) Matchers() []Matcher {
+	return r.matchers
+}
+
+// Name 返回路由名称
+func (r *route) Name() string {
+	return r.name
+}
+
+// Middlewares 返回路由生效的中间件数量
+func (r *route) Middlewares() int {
+	return r.middlewares
+}
+
+// Disabled 返回路由是否已停用
+func (r *route) Disabled() bool {
+	return r.disabled.Load()
+}
+
+// Meta 按 key 获取元数据
+func (r *route) Meta(key string) (value any, has bool) {
+	if m := r.meta.Load(); m != nil {
+		value, has = (*m)[key]
+	}
+	return value, has
+}
+
+// Metadata 返回全部元数据的副本
+func (r *route) Metadata() map[string]any {
+	var m = map[string]any{}
+	if loaded := r.meta.Load(); loaded != nil {
+		maps.Copy(m, *loaded)
+	}
+	return m
+}
+
+// clone 复制路由，停用状态及元数据与复制时相同
+func (r *route) clone() *route {
+	var c = &route{
+		Handler:     r.Handler,
+		path:        r.path,
+		host:        r.host,
+		method:      r.method,
+		name:        r.name,
+		middlewares: r.middlewares,
+		matchers:    r.matchers,
+		segments:    r.segments,
+		options:     r.options,
+	}
+	c.disabled.Store(r.disabled.Load())
+	c.meta.Store(r.meta.Load())
+	return c
+}
+
+// setMeta 复制元数据后设置，与正在读取的请求互不影响
+func (r *route) setMeta(key string, value any) {
+	for {
+		var old = r.meta.Load()
+		var m = map[string]any{key: value}
+		if old != nil {
+			m = maps.Clone(*old)
+			m[key] = value
+		}
+		if r.meta.CompareAndSwap(old, &m) {
+			return
+		}
+	}
+}
+
+// RouteFromContext 获取 context 中保存的匹配到的路由，未匹配到路由时返回 nil
+func RouteFromContext(ctx context.Context) Route {
+	r, _ := ctx.Value(RouteCtxKey).(Route)
+	return r
+}
+
+// WithRoute 将匹配到的路由保存到 context 中
+func WithRoute(ctx context.Context, r Route) context.Context {
+	return context.WithValue(ctx, RouteCtxKey, r)
+}
+
+// Name 实现 RouteSetter
+func (rs *routeSetter) Name(name string) RouteSetter {
+	if err := rs.TryName(name); err != nil {
+		panic(err)
+	}
+	return rs
+}
+
+// TryName 实现 RouteSetter
+func (rs *routeSetter) TryName(name string) error {
+	if len(rs.routes) == 0 {
+		return nil
+	}
+	var renamed = make([]*route, len(rs.routes))
+	for i, r := range rs.routes {
+		renamed[i] = r.clone()
+		renamed[i].name = name
+	}
+	var err = rs.router.tables.update(func(t *routeTable) error {
+		if named, has := t.names.get(name); has && named != rs.routes[0] {
+			return fmt.Errorf("conflict route name: %s path: %s ", name, rs.routes[0].path)
+		}
+		for i, r := range rs.routes {
+			t.rename(r, renamed[i])
+		}
+		t.names.set(name, renamed[0])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	rs.routes = renamed
+	return nil
+}
+
+// Meta 实现 RouteSetter
+func (rs *routeSetter) Meta(key string, value any) RouteSetter {
+	for _, r := range rs.routes {
+		r.setMeta(key, value)
+	}
+	return rs
+}
+
+// Disable 实现 RouteSetter
+func (rs *routeSetter) Disable() RouteSetter {
+	for _, r := range rs.routes {
+		r.disabled.Store(true)
+	}
+	return rs
+}
+
+// Enable 实现 RouteSetter
+func (rs *routeSetter) Enable() RouteSetter {
+	for _, r := range rs.routes {
+		r.disabled.Store(false)
+	}
+	return rs
+}
+
+// Remove 实现 RouteSetter
+func (rs *routeSetter) Remove() {
+	_ = rs.router.tables.update(func(t *routeTable) error {
+		var removed = false
+		for _, r := range rs.routes {
+			removed = t.remove(r) || removed
+		}
+		if !removed {
+			return errNotChanged
+		}
+		return nil
+	})
+}
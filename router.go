@@ -1,11 +1,17 @@
 package seed
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var rexp = regexp.MustCompile(`/+`)
@@ -13,7 +19,26 @@ var rexp = regexp.MustCompile(`/+`)
 // RouteMapper 路由匹配器
 type RouteMapper interface {
 	Add(route Route) error
-	Find(req *http.Request) Route
+
+	// Find 查找请求匹配的路由
+	//
+	// 	捕获的参数追加到 ps 后返回，调用方可以复用 ps 以避免内存分配
+	// 	path 匹配但路由的 Matcher 都不满足时返回 *MatchError
+	Find(req *http.Request, ps Params) (Route, Params, error)
+
+	// Allowed 返回能匹配请求 path 的全部请求方法
+	Allowed(req *http.Request) []string
+
+	// Routes 按注册顺序返回全部路由
+	Routes() []Route
+
+	// Remove 删除路由，路由不存在时返回 false
+	Remove(route Route) bool
+
+	// Clone 返回匹配器的副本，修改副本不会影响原匹配器
+	//
+	// 	Add、Remove 不是并发安全的，Router 修改路由时先 Clone 出副本，修改完成后再原子替换
+	Clone() RouteMapper
 }
 
 // Router 路由器
@@ -31,17 +56,33 @@ type Router interface {
 	//
 	// 	method  是http方法，如GET、POST,也可以使用逗号来连接同时传入多个，如 "GET,POST"
 	// 	也可以用特殊的 ANY,会自动注册所有( ANY 的取值详见 MethodAny )
+	// 	path 是路由路径，支持 :name 或 {name} 形式的命名参数，如 "/user/:id/orders"
+	// 	参数可以带约束 {name:constraint}，如 "/order/{id:[0-9]+}"、"/user/{id:int}"，不满足约束的分段不会匹配
+	// 	末尾的 *name 会匹配剩余的全部路径(包括 /)，如 "/static/*filepath"
 	// 	handler 是业务的逻辑
 	// 	ms 是该接口特有的中间件函数
-	HandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc)
+	HandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc) RouteSetter
 
 	// HandleFunc 以HandlerFunc方式注册业务handler
 	//
 	// 	method  是http方法，如GET、POST,也可以使用逗号来连接同时传入多个，如 "GET,POST"
 	// 	也可以用特殊的 ANY,会自动注册所有( ANY 的取值详见 MethodAny )
+	// 	path 是路由路径，支持 :name 或 {name} 形式的命名参数，如 "/user/:id/orders"
+	// 	参数可以带约束 {name:constraint}，如 "/order/{id:[0-9]+}"、"/user/{id:int}"，不满足约束的分段不会匹配
+	// 	末尾的 *name 会匹配剩余的全部路径(包括 /)，如 "/static/*filepath"
 	// 	handler 是业务的逻辑
 	// 	ms 是该接口特有的中间件函数
-	HandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc)
+	HandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc) RouteSetter
+
+	// TryHandleStd 与 HandleStd 相同，注册失败时返回 error 而不是 panic，并且会检查有歧义的路由
+	//
+	// 	error 汇总了全部无效的方法、冲突及有歧义的路由，有任何错误时不会注册任何路由
+	// 	有歧义是指两个路由能匹配同一个 path，且各有更优先的段，如 "/a/*/c" 与 "/a/b/*"
+	// 	HandleStd、HandleFunc 不检查歧义，这类路由按最长静态前缀优先匹配
+	TryHandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc) (RouteSetter, error)
+
+	// TryHandleFunc 与 HandleFunc 相同，注册失败时返回 error 而不是 panic，详见 TryHandleStd
+	TryHandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc) (RouteSetter, error)
 
 	// Group 路由分组
 	//
@@ -49,187 +90,543 @@ type Router interface {
 	// 	prefix路由前缀，如 "/user"
 	// 	ms 是该分组的中间件函数
 	Group(prefix string, f func(r Router), ms ...MiddlewareFunc)
-}
 
-// routeNode 路由匹配器节点
-type routeNode struct {
-	route    Route
-	children map[string]*routeNode
-}
+	// NotFound 设置 404 处理器
+	//
+	// 	在分组中设置时只对分组 prefix (及 host) 下的请求生效，请求所在的最内层分组的设置优先
+	// 	最内层有多个分组时，字面量前缀优先于参数前缀，限定 host 的分组优先，其余按设置顺序
+	// 	处理器会经过设置时已注册的中间件，包括分组的中间件
+	// 	与路由一样保存在路由表中，运行中设置是并发安全的，在 Update 中设置时随路由一起生效
+	// 	未设置时使用 NotFoundHandler
+	NotFound(handlerFunc HandlerFunc) Router
+
+	// MethodNotAllowed 设置 405 处理器
+	//
+	// 	当请求的 path 只注册了其他方法时调用，调用前已设置好 Allow Header
+	// 	生效范围与 NotFound 相同，未设置时使用 MethodNotAllowedHandler
+	MethodNotAllowed(handlerFunc HandlerFunc) Router
+
+	// URL 根据路由名称反向生成 URL
+	//
+	// 	pairs 是成对的 key、value，如 URL("user", "id", "42", "tab", "orders")
+	// 	路径中的参数会被替换并转义，多余的参数作为查询参数追加，缺少路径参数时返回 error
+	URL(name string, pairs ...string) (string, error)
+
+	// Routes 按注册顺序返回全部路由，包括其他分组中注册的路由
+	Routes() []Route
+
+	// Mount 将 http.Handler 挂载到 prefix 下
+	//
+	// 	prefix 下的全部路径及方法都会交给 handler 处理，handler 收到的请求 path 已去掉 prefix
+	// 	原始的请求 path 可以通过 OriginalPath 获取
+	// 	handler 可以是另一个 Router，也可以是第三方的 http.Handler，如 http.FileServer
+	// 	当前路由器的中间件以及 ms 会在 handler 之前执行
+	// 	挂载的路由默认不出现在 OpenAPI 文档中
+	Mount(prefix string, handler http.Handler, ms ...MiddlewareFunc) RouteSetter
 
-// routeMapper 路由匹配器
-type routeMapper struct {
-	tree map[string]*routeNode
+	// TryMount 与 Mount 相同，注册失败时返回 error 而不是 panic，详见 TryHandleStd
+	TryMount(prefix string, handler http.Handler, ms ...MiddlewareFunc) (RouteSetter, error)
+
+	// Host 按 host 划分路由
+	//
+	// 	pattern 可以是完整的 host，如 "api.example.com"，也可以包含参数，如 "{tenant}.example.com"
+	// 	host 中捕获的参数与路径参数一样可以通过 Request.PathParam 获取
+	// 	f 中注册的路由只匹配该 host 的请求，未匹配时继续匹配不限 host 的路由
+	// 	ms 是该分组的中间件函数
+	Host(pattern string, f func(r Router), ms ...MiddlewareFunc)
+
+	// Match 返回带附加匹配条件的路由器，通过它注册的路由需要同时满足 matchers
+	//
+	// 	如 r.Match(AcceptMatcher("application/vnd.v2+json")).HandleFunc("GET", "/user", v2)
+	// 	同一 path 可以注册多个带不同条件的路由，都不满足时根据 Matcher 响应 404、406 或 415
+	Match(matchers ...Matcher) Router
+
+	// Walk 按注册顺序遍历全部路由，fn 返回 error 时停止遍历并返回该 error
+	Walk(fn func(route Route) error) error
+
+	// Update 批量修改路由表，修改在 f 返回后一次性生效
+	//
+	// 	路由表采用 copy-on-write，运行中注册、删除路由是并发安全的，请求不会看到修改的中间状态
+	// 	f 中需要通过参数 r 注册路由，f 返回 error 时放弃全部修改
+	// 	f 执行期间路由表被其他修改替换时(包括在 f 中使用外层的 Router)放弃全部修改并返回 error，可以重试
+	Update(f func(r Router) error) error
+
+	// Swap 使用 f 中注册的路由替换全部路由，用法与 Update 相同
+	//
+	// 	f 中的 r 从空的路由表开始注册，替换后原有的路由及路由名称都会失效
+	// 	NotFound、MethodNotAllowed 设置的处理器会保留
+	Swap(f func(r Router) error) error
+
+	// Remove 删除路由，返回是否有路由被删除
+	//
+	// 	methods 与 path 的写法与 HandleStd 相同，path 会加上当前分组的 prefix
+	// 	同一 path 通过 Match 注册了多个路由时会全部删除
+	Remove(methods string, path string) bool
+
+	// OpenAPI 注册 GET path 路由，输出根据全部路由生成的 OpenAPI 3.1 文档
+	//
+	// 	path 以 .yaml 或 .yml 结尾时输出 YAML，否则输出 JSON
+	// 	文档在每次请求时生成，运行中修改的路由会反映在文档中，详见 NewOpenAPI
+	OpenAPI(path string, info OpenAPIInfo, ms ...MiddlewareFunc) RouteSetter
+
+	// TryOpenAPI 与 OpenAPI 相同，注册失败时返回 error 而不是 panic，详见 TryHandleStd
+	TryOpenAPI(path string, info OpenAPIInfo, ms ...MiddlewareFunc) (RouteSetter, error)
+
+	// Static 将 fsys 中的文件注册到 prefix 下，fsys 可以是 embed.FS 或 os.DirFS
+	//
+	// 	支持 ETag、Last-Modified、Range 请求，请求接受 gzip 且存在同名 .gz 文件时输出压缩后的文件
+	// 	目录输出其中的 index.html，opts 可以开启目录列表、设置 Cache-Control 及单页应用的首页
+	// 	当前路由器的中间件对静态文件同样生效
+	// 	静态文件路由默认不出现在 OpenAPI 文档中
+	Static(prefix string, fsys fs.FS, opts ...StaticOption) RouteSetter
+
+	// TryStatic 与 Static 相同，注册失败时返回 error 而不是 panic，详见 TryHandleStd
+	TryStatic(prefix string, fsys fs.FS, opts ...StaticOption) (RouteSetter, error)
 }
 
 // router 路由器
 type router struct {
 	prefix          string
-	mapper          RouteMapper
+	host            string
+	matchers        []Matcher
+	tables          *routeTables
 	middlewareFuncs MiddlewareFuncs
-	notFound        http.Handler
+	options         routerOptions
+
+	// builtin 内置处理器的中间件链，见 builtins
+	builtin *atomic.Pointer[builtinHandlers]
 }
 
-// Find  实现 RouteMapper
-func (rm *routeMapper) Find(req *http.Request) Route {
-	if node, ok := rm.tree[req.Method]; ok {
-		var segments = rm.segment(req.URL.Path)
-		var nodes = []*routeNode{node}
-		var matchedNode *routeNode
+// routeLeaf 节点上注册的路由及路由中声明的参数名
+//
+// 带 Matcher 的路由按注册顺序排在前面，不带 Matcher 的路由最多一个且排在最后
+type routeLeaf struct {
+	route Route
+	names []string
+}
 
-		for _, segment := range segments {
-			var nextNodes []*routeNode
-			for _, node = range nodes {
-				if matchedNode, ok = node.children[segment]; ok {
-					nextNodes = append(nextNodes, matchedNode)
-				}
-				if matchedNode, ok = node.children["*"]; ok {
-					nextNodes = append(nextNodes, matchedNode)
-				}
-			}
-			nodes = nextNodes
+// routeLeaves 同一节点上注册的路由
+type routeLeaves []*routeLeaf
+
+// matchContext 一次匹配过程的状态
+type matchContext struct {
+	// req 用于校验 Matcher，为 nil 时不校验
+	req *http.Request
+
+	// status 第一个不满足的 Matcher 给出的状态码
+	status int
+}
+
+// accept 返回第一个满足全部 Matcher 的路由，已停用的路由会被跳过
+func (ls routeLeaves) accept(mc *matchContext) *routeLeaf {
+	for _, leaf := range ls {
+		if leaf.route.Disabled() {
+			continue
 		}
-		for _, v := range nodes {
-			if v.route != nil {
-				return v.route
-			}
+		if mc.req == nil {
+			return leaf
+		}
+		var failed = leaf.reject(mc.req)
+		if failed == nil {
+			return leaf
+		}
+		if status := failed.Status(); mc.status == 0 && status != http.StatusNotFound {
+			mc.status = status
 		}
 	}
 	return nil
 }
 
-// Add 实现 RouteMapper
-func (rm *routeMapper) Add(route Route) error {
-	var segments = rm.segment(route.Path())
-	var node, ok = rm.tree[route.Method()]
-	if !ok {
-		node = &routeNode{children: make(map[string]*routeNode)}
-		rm.tree[route.Method()] = node
+// add 添加路由，已有不带 Matcher 的路由时，再添加不带 Matcher 的路由会失败
+func (ls *routeLeaves) add(leaf *routeLeaf) bool {
+	var last = len(*ls) - 1
+	var hasDefault = last >= 0 && len((*ls)[last].route.Matchers()) == 0
+	if len(leaf.route.Matchers()) == 0 {
+		if hasDefault {
+			return false
+		}
+		*ls = append(*ls, leaf)
+		return true
 	}
+	if !hasDefault {
+		*ls = append(*ls, leaf)
+		return true
+	}
+	*ls = append((*ls)[:last], leaf, (*ls)[last])
+	return true
+}
 
-	for _, segment := range segments {
-		if child, ok := node.children[segment]; ok {
-			node = child
-			continue
+// reject 返回第一个不满足的 Matcher，全部满足时返回 nil
+func (l *routeLeaf) reject(req *http.Request) Matcher {
+	for _, m := range l.route.Matchers() {
+		if !m.Match(req) {
+			return m
 		}
-		var newNode = &routeNode{children: make(map[string]*routeNode)}
-		node.children[segment] = newNode
-		node = newNode
 	}
+	return nil
+}
 
-	if node.route == nil {
-		node.route = route
-		return nil
+// HandleStd 标准handler方式注册路由
+func (r *router) HandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc) RouteSetter {
+	return mustRegister(r.handle(methods, path, handler, false, ms...))
+}
+
+// mustRegister 注册失败时 panic
+func mustRegister(rs RouteSetter, err error) RouteSetter {
+	if err != nil {
+		panic(err)
 	}
-	return fmt.Errorf("conflict route method: %s path: %s ", route.Method(), route.Path())
+	return rs
 }
 
-// segment 对路由path进行分段
-func (rm *routeMapper) segment(path string) []string {
-	path = rexp.ReplaceAllString(strings.Trim(strings.ToLower(path), "/"), "/")
-	var segments = strings.Split(path, "/")
-	if path == "/" || path == "" {
-		segments = []string{"/"}
+// TryHandleStd 标准handler方式注册路由，检查有歧义的路由
+func (r *router) TryHandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc) (RouteSetter, error) {
+	return r.handle(methods, path, handler, true, ms...)
+}
+
+// handle 注册路由，以逗号连接的多个方法的路由同时生效，checkAmbiguous 为 true 时检查有歧义的路由
+func (r *router) handle(methods string, path string, handler http.Handler, checkAmbiguous bool, ms ...MiddlewareFunc) (RouteSetter, error) {
+	var sepMethods, err = parseMethods(methods, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var setter = &routeSetter{router: r}
+	var segments = parsePattern(r.prefix+path, r.options.strictSlash)
+	for _, method := range sepMethods {
+		setter.routes = append(setter.routes, &route{
+			path:        r.prefix + path,
+			host:        r.host,
+			matchers:    r.matchers,
+			method:      method,
+			middlewares: len(r.middlewareFuncs) + len(ms),
+			segments:    segments,
+			options:     r.options,
+			Handler:     r.TransHandler(handler, ms...),
+		})
 	}
-	return segments
+	err = r.tables.update(func(t *routeTable) error {
+		var errs []error
+		for _, route := range setter.routes {
+			if checkAmbiguous {
+				if err := t.checkAmbiguous(route, r.options.caseSensitive); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			if err := t.mapper.Add(route); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return setter, nil
 }
 
-// HandleStd 标准handler方式注册路由
-func (r *router) HandleStd(methods string, path string, handler http.Handler, ms ...MiddlewareFunc) {
-	var seps = strings.Split(methods, ",")
-	var sepMethods []string
-	var validMethod = false
+// TryHandleFunc handlerFunc方式注册路由
+func (r *router) TryHandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc) (RouteSetter, error) {
+	return r.TryHandleStd(methods, path, handlerFunc.Handler(), ms...)
+}
 
-	for _, v := range seps {
-		validMethod = false
+// parseMethods 解析以逗号连接的请求方法，ANY 展开为全部方法，返回的 error 汇总了全部无效的方法
+func parseMethods(methods string, path string) ([]string, error) {
+	var sepMethods []string
+	var errs []error
+	for _, v := range strings.Split(methods, ",") {
 		if v == MethodAny {
 			sepMethods = append(sepMethods, httpMethods...)
 			continue
 		}
-		for _, m := range httpMethods {
-			if v == m {
-				validMethod = true
-				break
-			}
-		}
-		if !validMethod {
-			panic(fmt.Errorf("invalid route method: %s path: %s ", v, path))
+		if !slices.Contains(httpMethods, v) {
+			errs = append(errs, fmt.Errorf("invalid route method: %s path: %s ", v, path))
+			continue
 		}
 		sepMethods = append(sepMethods, strings.ToUpper(v))
 	}
-
-	for _, method := range sepMethods {
-		var route = &route{
-			path:    r.prefix + path,
-			method:  method,
-			Handler: r.TransHandler(handler, ms...),
-		}
-		if err := r.mapper.Add(route); err != nil {
-			panic(err.Error())
-		}
-	}
+	return sepMethods, errors.Join(errs...)
 }
 
 // HandleFunc handlerFunc方式注册路由
-func (r *router) HandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc) {
-	r.HandleStd(methods, path, handlerFunc.Handler(), ms...)
+func (r *router) HandleFunc(methods string, path string, handlerFunc HandlerFunc, ms ...MiddlewareFunc) RouteSetter {
+	return r.HandleStd(methods, path, handlerFunc.Handler(), ms...)
 }
 
 // Group 新建路由组
 func (r *router) Group(prefix string, f func(r Router), ms ...MiddlewareFunc) {
+	var router = r.fork(ms...)
+
+	//keep prefix
+	router.prefix = r.prefix + prefix
+	f(router)
+	router.setOptions(r)
+}
+
+// fork 复制当前路由器，新路由器的中间件在当前中间件之后追加 ms
+func (r *router) fork(ms ...MiddlewareFunc) *router {
 	var mws = make([]MiddlewareFunc, len(r.middlewareFuncs))
 
 	//copy middlewares
 	_ = copy(mws, r.middlewareFuncs)
 	mws = append(mws, ms...)
 
-	//keep prefix
-	prefix = r.prefix + prefix
-	var router = &router{mapper: r.mapper, middlewareFuncs: mws, notFound: r.notFound, prefix: prefix}
-	f(router)
+	var router = *r
+	router.middlewareFuncs = mws
+	router.builtin = newBuiltin()
+	return &router
 }
 
 // ServeHTTP 实现 http.Handler
+//
+// 未注册 HEAD 时使用 GET 路由响应 HEAD 请求，未注册 OPTIONS 时自动响应 OPTIONS 请求
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if route := r.mapper.Find(req); route != nil {
-		route.ServeHTTP(w, req)
+	var reqPath = r.options.requestPath(req)
+	if r.options.cleanPathCode != 0 {
+		if cleaned := cleanPath(reqPath); cleaned != reqPath {
+			r.redirect(w, req, cleaned, r.options.cleanPathCode)
+			return
+		}
+	}
+
+	var t = r.tables.load()
+	var route, ps, err = r.find(t, req, req.Method, reqPath)
+	var head = route == nil && req.Method == MethodHead
+	if head {
+		route, ps, err = r.find(t, req, MethodGet, reqPath)
+	}
+	if route != nil {
+		if r.options.redirectSlashCode != 0 {
+			if canonical := canonicalPath(reqPath, route.Path()); canonical != reqPath {
+				r.redirect(w, req, canonical, r.options.redirectSlashCode)
+				return
+			}
+		}
+		if head {
+			var hw = &headResponseWriter{ResponseWriter: w}
+			r.serve(hw, req, route, ps)
+			hw.finish()
+			return
+		}
+		r.serve(w, req, route, ps)
+		return
+	}
+	if r.options.redirectSlashCode != 0 && r.options.strictSlash {
+		var method = req.Method
+		if head {
+			method = MethodGet
+		}
+		var alternate = toggleSlash(rexp.ReplaceAllString(reqPath, "/"))
+		if route, _, _ = r.find(t, req, method, alternate); route != nil {
+			r.redirect(w, req, alternate, r.options.redirectSlashCode)
+			return
+		}
+	}
+
+	var matchErr *MatchError
+	if errors.As(err, &matchErr) {
+		r.builtins().matchError.ServeHTTP(w, withMatchError(req, matchErr))
+		return
+	}
+
+	// path 匹配但被 Matcher 拒绝的方法按未匹配到路由处理
+	if allowed := r.allowed(t, req); len(allowed) > 0 && (req.Method == MethodOptions || !slices.Contains(allowed, req.Method)) {
+		w.Header().Set(HeaderAllow, strings.Join(allowed, ", "))
+		if req.Method == MethodOptions {
+			var h = r.fallbackHandler(t, req, reqPath, func(fb *fallback) http.Handler { return fb.options })
+			if h == nil {
+				h = r.builtins().options
+			}
+			h.ServeHTTP(w, req)
+			return
+		}
+		var h = r.fallbackHandler(t, req, reqPath, func(fb *fallback) http.Handler { return fb.methodNotAllowed })
+		if h == nil {
+			h = r.builtins().methodNotAllowed
+		}
+		h.ServeHTTP(w, req)
 		return
 	}
-	if r.notFound == nil {
-		r.notFound = r.TransHandler(NotFoundHandler.Handler())
+	var h = r.fallbackHandler(t, req, reqPath, func(fb *fallback) http.Handler { return fb.notFound })
+	if h == nil {
+		h = r.builtins().notFound
 	}
-	r.notFound.ServeHTTP(w, req)
+	h.ServeHTTP(w, req)
+}
+
+// requestPath 返回用于匹配的请求路径，使用 WithRawPath 时是未解码的路径
+func (r *router) requestPath(req *http.Request) string {
+	if r.options.useRawPath {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.Path
+}
+
+// paramsPool 查找路由时捕获路径参数的缓冲区
+var paramsPool = sync.Pool{New: func() any {
+	var ps = make(Params, 0, 8)
+	return &ps
+}}
+
+// find 在路由表 t 中以指定的请求方法及路径查找路由
+//
+// 捕获的参数先写入复用的缓冲区，匹配成功后才复制一份大小正好的 Params
+func (r *router) find(t *routeTable, req *http.Request, method string, reqPath string) (Route, Params, error) {
+	if req.Method != method || r.options.requestPath(req) != reqPath {
+		var mreq = *req
+		var u = *req.URL
+		mreq.Method = method
+		mreq.URL = &u
+		u.Path, u.RawPath = reqPath, ""
+		if r.options.useRawPath {
+			if unescaped, err := url.PathUnescape(reqPath); err == nil {
+				u.Path, u.RawPath = unescaped, reqPath
+			}
+		}
+		req = &mreq
+	}
+
+	var buf = paramsPool.Get().(*Params)
+	var route, ps, err = t.mapper.Find(req, (*buf)[:0])
+	var params Params
+	if route != nil && len(ps) > 0 {
+		params = make(Params, len(ps))
+		_ = copy(params, ps)
+	}
+	*buf = ps[:0]
+	paramsPool.Put(buf)
+	return route, params, err
+}
+
+// redirect 重定向到指定路径，保留请求的查询参数
+func (r *router) redirect(w http.ResponseWriter, req *http.Request, target string, code int) {
+	var u = url.URL{Path: target, RawQuery: req.URL.RawQuery}
+	if r.options.useRawPath {
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			u.Path, u.RawPath = unescaped, target
+		}
+	}
+	r.builtins().redirect.ServeHTTP(w, withRedirect(req, redirectTarget{url: u.String(), code: code}))
+}
+
+// serve 将匹配到的路由及路径参数保存到请求的 context 中并执行路由
+func (r *router) serve(w http.ResponseWriter, req *http.Request, route Route, ps Params) {
+	// 总是覆盖，挂载的路由器不能取到外层路由的参数
+	var ctx = WithParams(WithRoute(req.Context(), route), ps)
+	route.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// cleanPath 清理路径中的 . 、.. 及重复的 /，保留末尾的 /
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	var cleaned = path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// canonicalPath 返回请求在路由 pattern 下的规范路径
+//
+// 合并重复的 /，末尾是否有 / 与 pattern 一致；pattern 以末尾通配结尾时保留请求末尾的 /
+func canonicalPath(reqPath string, pattern string) string {
+	var canonical = rexp.ReplaceAllString(reqPath, "/")
+	if canonical == "/" || canonical == "" {
+		return "/"
+	}
+	var lastSlash = strings.LastIndexByte(strings.TrimSuffix(pattern, "/"), '/')
+	if _, isCatchAll := catchAllName(pattern[lastSlash+1:]); isCatchAll {
+		return canonical
+	}
+	if strings.HasSuffix(pattern, "/") != strings.HasSuffix(canonical, "/") {
+		canonical = toggleSlash(canonical)
+	}
+	return canonical
+}
+
+// toggleSlash 增加或去掉路径末尾的 /
+func toggleSlash(p string) string {
+	if p == "/" || p == "" {
+		return "/"
+	}
+	if strings.HasSuffix(p, "/") {
+		return strings.TrimSuffix(p, "/")
+	}
+	return p + "/"
+}
+
+// allowed 返回请求 path 支持的全部方法，包括由 GET 隐含的 HEAD 以及自动响应的 OPTIONS
+func (r *router) allowed(t *routeTable, req *http.Request) []string {
+	var registered = t.mapper.Allowed(req)
+	if len(registered) == 0 {
+		return nil
+	}
+	var set = make(map[string]bool, len(registered)+2)
+	for _, method := range registered {
+		set[method] = true
+	}
+	set[MethodHead] = set[MethodHead] || set[MethodGet]
+	set[MethodOptions] = true
+
+	var allowed = make([]string, 0, len(set))
+	for _, method := range httpMethods {
+		if set[method] {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
 }
 
 // Use 添加路由中间件
 func (r *router) Use(ms ...MiddlewareFunc) Router {
 	if len(ms) > 0 {
 		r.middlewareFuncs = append(r.middlewareFuncs, ms...)
+		r.builtin.Store(nil)
 	}
 	return r
 }
 
-// TransHandler 将Handler 合并当前路由中间件成实际的route handler
-func (r *router) TransHandler(h http.Handler, ms ...MiddlewareFunc) http.Handler {
-	ms = append(r.middlewareFuncs, ms...)
-	var f http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
-		var mw MiddlewareFunc = func(ctx context.Context, ww http.ResponseWriter, rr *http.Request, next MiddleWareQueue) bool {
-			h.ServeHTTP(ww, rr)
-			return false
+// Routes 实现 Router
+func (r *router) Routes() []Route {
+	return r.tables.load().mapper.Routes()
+}
+
+// Walk 实现 Router
+func (r *router) Walk(fn func(route Route) error) error {
+	for _, route := range r.tables.load().mapper.Routes() {
+		if err := fn(route); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		var mws MiddlewareFuncs = append(ms, mw)
-		mws.Next(r.Context(), w, r)
+// TransHandler 将Handler 合并当前路由中间件成实际的route handler
+//
+// 中间件链在调用时组装一次，此后修改路由器的中间件不会影响已返回的 handler
+func (r *router) TransHandler(h http.Handler, ms ...MiddlewareFunc) http.Handler {
+	var mws = make(MiddlewareFuncs, 0, len(r.middlewareFuncs)+len(ms))
+	mws = append(append(mws, r.middlewareFuncs...), ms...)
+	var chain = newMiddlewareChain(mws, h)
+	var f http.HandlerFunc = func(w http.ResponseWriter, req *http.Request) {
+		chain.Next(req.Context(), w, req)
 	}
 	return f
 }
 
 // NewRouter 返回一个Router实例
-func NewRouter() Router {
+//
+//	opts 是路由器的配置项，如 WithCaseSensitive、WithRawPath
+func NewRouter(opts ...RouterOption) Router {
+	var options = newRouterOptions(opts...)
 	return &router{
 		prefix:          "",
-		mapper:          &routeMapper{tree: map[string]*routeNode{}},
+		tables:          newRouteTables(newRouteTable(options)),
+		options:         options,
 		middlewareFuncs: []MiddlewareFunc{},
-		notFound:        nil,
+		builtin:         newBuiltin(),
 	}
 }
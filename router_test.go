@@ -2,22 +2,26 @@ package seed
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestRouter(t *testing.T) {
-	var notFound http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte("404 NOT FOUND"))
-	}
-	var rs = &router{
-		mapper: &routeMapper{
-			tree: map[string]*routeNode{},
-		},
-		notFound: notFound,
+	var notFound HandlerFunc = func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusNotFound, "404 NOT FOUND")
 	}
+	var rs = NewRouter().(*router)
+	rs.NotFound(notFound)
 	var h http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("index hello world"))
 	}
@@ -25,23 +29,1270 @@ func TestRouter(t *testing.T) {
 		return next.Next(ctx, w, req)
 	})
 	rs.HandleStd(http.MethodPost, "/", h)
-	rs.HandleStd("POST", "/", h)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("want conflict route to panic")
+			}
+		}()
+		rs.HandleStd("POST", "/", h)
+	}()
 	rs.HandleStd(http.MethodPost, "/a/b/c/d", h)
 	rs.HandleStd(http.MethodPost, "/a/b/*/d", h)
 	rs.HandleStd(http.MethodPost, "/a/b", h)
 	rs.HandleStd(http.MethodGet, "/", h)
 
-	var node = rs.mapper.(*routeMapper)
-	var mode = node.tree["GET"]
-
 	var req = &http.Request{
 		URL: &url.URL{
 			Path: "",
 		},
 		Method: "GET",
 	}
-	var r = rs.mapper.Find(req)
-	_ = http.ListenAndServe(":8080", rs)
-	fmt.Println(r)
-	fmt.Println(mode)
+	if r, _, _ := rs.tables.load().mapper.Find(req, nil); r == nil || r.Path() != "/" {
+		t.Fatalf("want route / for empty path, got %v", r)
+	}
+
+	var cases = map[string]string{
+		"/a/b/c/d": "index hello world",
+		"/a/b/x/d": "index hello world",
+		"/a/b":     "index hello world",
+		"/a/b/x":   "404 NOT FOUND",
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Body.String() != body {
+			t.Errorf("POST %s: want %q, got %q", path, body, w.Body.String())
+		}
+	}
+}
+
+func TestRouterPathParam(t *testing.T) {
+	var rs = NewRouter()
+	rs.HandleFunc(MethodGet, "/user/:id/orders/{order}", func(ctx context.Context, req Request) Response {
+		var id, _ = req.PathParam("id")
+		return JsonResponse(http.StatusOK, []string{id, req.PathParamDefault("order"), req.PathParamDefault("none", "x")})
+	})
+	rs.HandleFunc(MethodGet, "/user/*/profile", func(ctx context.Context, req Request) Response {
+		var _, has = req.PathParam("*")
+		return JsonResponse(http.StatusOK, has)
+	})
+
+	var cases = map[string]string{
+		"/user/Tom/orders/42": `["Tom","42","x"]`,
+		"/USER/7/ORDERS/A1":   `["7","A1","x"]`,
+		"/user/7/profile":     `false`,
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != body {
+			t.Errorf("GET %s: want %s, got %s", path, body, w.Body.String())
+		}
+	}
+}
+
+func TestRouterCatchAll(t *testing.T) {
+	var rs = NewRouter()
+	var reply = func(name string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, name+":"+req.PathParamDefault("filepath"))
+		}
+	}
+	rs.HandleFunc(MethodGet, "/static/*filepath", reply("static"))
+	rs.HandleFunc(MethodGet, "/static/:name", reply("name"))
+	rs.HandleFunc(MethodGet, "/static/favicon.ico", reply("favicon"))
+	rs.HandleFunc(MethodGet, "/*filepath", reply("root"))
+
+	var cases = map[string]string{
+		"/static/favicon.ico": "favicon:",
+		"/static/app.js":      "name:",
+		"/static/js/App.js":   "static:js/App.js",
+		"/static/":            "static:",
+		"/":                   "root:",
+		"/index/a/b":          "root:index/a/b",
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != body {
+			t.Errorf("GET %s: want %q, got %q", path, body, w.Body.String())
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("want catch-all in the middle to panic")
+			}
+		}()
+		rs.HandleFunc(MethodGet, "/a/*filepath/b", reply("bad"))
+	}()
+}
+
+func TestRouterConstraint(t *testing.T) {
+	var rs = NewRouter()
+	var reply = func(name string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			var v, _ = req.PathParam("id")
+			return HtmlResponse(http.StatusOK, name+":"+v)
+		}
+	}
+	rs.HandleFunc(MethodGet, "/order/{id:[0-9]+}", reply("number"))
+	rs.HandleFunc(MethodGet, "/order/{id:alpha}", reply("alpha"))
+	rs.HandleFunc(MethodGet, "/order/:id", reply("any"))
+	rs.HandleFunc(MethodGet, "/file/{id:.+\\.pdf}", reply("pdf"))
+	rs.HandleFunc(MethodGet, "/user/{id:uuid}", reply("uuid"))
+	rs.HandleFunc(MethodGet, "/item/{id:int}/detail", reply("int"))
+
+	var cases = map[string]string{
+		"/order/42":       "number:42",
+		"/order/Abc":      "alpha:Abc",
+		"/order/a-1":      "any:a-1",
+		"/file/A.pdf":     "pdf:A.pdf",
+		"/file/a.pdfx":    "404",
+		"/item/-3/detail": "int:-3",
+		"/item/x/detail":  "404",
+		"/user/123e4567-e89b-12d3-a456-426614174000": "uuid:123e4567-e89b-12d3-a456-426614174000",
+		"/user/123": "404",
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if body == "404" {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("GET %s: want 404, got %d", path, w.Code)
+			}
+			continue
+		}
+		if w.Body.String() != body {
+			t.Errorf("GET %s: want %q, got %q", path, body, w.Body.String())
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("want invalid constraint to panic")
+			}
+		}()
+		rs.HandleFunc(MethodGet, "/bad/{id:[0-9}", reply("bad"))
+	}()
+}
+
+func TestRouterPriority(t *testing.T) {
+	var cases = []struct {
+		routes []string
+		path   string
+		want   string
+		params Params
+	}{
+		{[]string{"/a/b", "/a/:x", "/a/{x:int}", "/a/*rest"}, "/a/b", "/a/b", nil},
+		{[]string{"/a/b", "/a/:x", "/a/{x:int}", "/a/*rest"}, "/a/1", "/a/{x:int}", Params{{"x", "1"}}},
+		{[]string{"/a/b", "/a/:x", "/a/{x:int}", "/a/*rest"}, "/a/c", "/a/:x", Params{{"x", "c"}}},
+		{[]string{"/a/b", "/a/:x", "/a/{x:int}", "/a/*rest"}, "/a/c/d", "/a/*rest", Params{{"rest", "c/d"}}},
+		{[]string{"/a/{x:[0-9]+}", "/a/{x:int}"}, "/a/7", "/a/{x:[0-9]+}", Params{{"x", "7"}}},
+		// backtracking: the literal branch dead-ends, the param branch matches deeper
+		{[]string{"/a/b/c", "/a/:x/d"}, "/a/b/d", "/a/:x/d", Params{{"x", "b"}}},
+		{[]string{"/a/b/c", "/a/{x:alpha}/d", "/a/:x/e"}, "/a/b/e", "/a/:x/e", Params{{"x", "b"}}},
+		{[]string{"/a/b/c", "/a/*rest"}, "/a/b/d", "/a/*rest", Params{{"rest", "b/d"}}},
+		{[]string{"/a/b/*rest", "/a/*rest"}, "/a/b/d", "/a/b/*rest", Params{{"rest", "d"}}},
+		{[]string{"/a/:x/:y", "/a/*rest"}, "/a/b", "/a/*rest", Params{{"rest", "b"}}},
+		{[]string{"/*rest", "/"}, "/", "/", nil},
+		{[]string{"/*rest"}, "/", "/*rest", Params{{"rest", ""}}},
+		{[]string{"/a/b"}, "/a/b/c", "", nil},
+		// a literal request segment "*" must not be taken for a parameter
+		{[]string{"/a/:x/c"}, "/a/*/c", "/a/:x/c", Params{{"x", "*"}}},
+		{[]string{"/users", "/user/:id"}, "/user/1", "/user/:id", Params{{"id", "1"}}},
+		{[]string{"/a/bc", "/a/:x"}, "/a/bcd", "/a/:x", Params{{"x", "bcd"}}},
+		{[]string{"/stat", "/static/*path"}, "/static", "/static/*path", Params{{"path", ""}}},
+		{[]string{"/a/:x/:y"}, "/A//b//C/", "/a/:x/:y", Params{{"x", "b"}, {"y", "C"}}},
+	}
+	var mappers = map[string]func() benchMapper{
+		"radix": func() benchMapper { return newRadixMapper(routerOptions{}) },
+		"map":   func() benchMapper { return &routeMapper{tree: map[string]*routeNode{}} },
+	}
+	for name, newMapper := range mappers {
+		for _, c := range cases {
+			var rm = newMapper()
+			for _, p := range c.routes {
+				if err := rm.Add(&route{method: MethodGet, path: p}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var r, ps, _ = rm.Find(httptest.NewRequest(MethodGet, c.path, nil), nil)
+			var got string
+			if r != nil {
+				got = r.Path()
+			}
+			if got != c.want || !reflect.DeepEqual(ps, c.params) {
+				t.Errorf("%s routes %v GET %s: want %q %v, got %q %v", name, c.routes, c.path, c.want, c.params, got, ps)
+			}
+		}
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	var rs = NewRouter()
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}
+	rs.HandleFunc("POST,PUT", "/user/:id", h)
+	rs.HandleFunc(MethodDelete, "/user/*rest", h)
+
+	var w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/1", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get(HeaderAllow) != "POST, PUT, DELETE, OPTIONS" {
+		t.Fatalf("want 405 with Allow, got %d %q", w.Code, w.Header().Get(HeaderAllow))
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/order/1", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get(HeaderAllow) != "" {
+		t.Fatalf("want 404 without Allow, got %d %q", w.Code, w.Header().Get(HeaderAllow))
+	}
+
+	rs.MethodNotAllowed(func(ctx context.Context, req Request) Response {
+		return JsonResponse(http.StatusMethodNotAllowed, "custom")
+	})
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/1/a", nil))
+	if w.Body.String() != `"custom"` || w.Header().Get(HeaderAllow) != "DELETE, OPTIONS" {
+		t.Fatalf("want custom 405 handler, got %q %q", w.Body.String(), w.Header().Get(HeaderAllow))
+	}
+}
+
+func TestRouterHeadOptions(t *testing.T) {
+	var rs = NewRouter()
+	rs.HandleFunc(MethodGet, "/json", func(ctx context.Context, req Request) Response {
+		return JsonResponse(http.StatusOK, "hello")
+	})
+	rs.HandleStd(MethodGet, "/raw", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Raw", "1")
+		_, _ = w.Write([]byte("hello"))
+		_, _ = w.Write([]byte(" world"))
+	}))
+	rs.HandleFunc(MethodPost, "/raw", func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	})
+	rs.HandleFunc(MethodOptions, "/json", func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusTeapot)
+	})
+
+	var w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/json", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get(HeaderContentLength) != "7" {
+		t.Fatalf("HEAD /json: got %d %q %q", w.Code, w.Body.String(), w.Header().Get(HeaderContentLength))
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/raw", nil))
+	if w.Body.Len() != 0 || w.Header().Get(HeaderContentLength) != "11" || w.Header().Get("X-Raw") != "1" {
+		t.Fatalf("HEAD /raw: got %q %v", w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/raw", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get(HeaderAllow) != "GET, HEAD, POST, OPTIONS" {
+		t.Fatalf("OPTIONS /raw: got %d %q", w.Code, w.Header().Get(HeaderAllow))
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/json", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("OPTIONS /json: want registered route, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/none", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("HEAD /none: want 404, got %d", w.Code)
+	}
+
+	// group middleware such as CORS runs for the automatic OPTIONS response
+	var cors MiddlewareFunc = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return next.Next(ctx, w, req)
+	}
+	rs.Group("/api", func(r Router) {
+		r.HandleFunc(MethodPost, "/x", func(ctx context.Context, req Request) Response {
+			return NopResponse(http.StatusOK)
+		})
+		r.Group("/v1", func(r Router) {
+			r.HandleFunc(MethodPut, "/y", func(ctx context.Context, req Request) Response {
+				return NopResponse(http.StatusOK)
+			})
+		})
+	}, cors)
+	for _, p := range []string{"/api/x", "/api/v1/y"} {
+		w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, p, nil))
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatalf("OPTIONS %s: want group middleware, got %d %v", p, w.Code, w.Header())
+		}
+	}
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/raw", nil))
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("OPTIONS /raw: want no group middleware outside the group, got %v", w.Header())
+	}
+}
+
+func TestRouterOptions(t *testing.T) {
+	var reply = func(name string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, name+":"+req.PathParamDefault("id"))
+		}
+	}
+
+	var rs = NewRouter(WithCaseSensitive())
+	rs.HandleFunc(MethodGet, "/Files/:id", reply("upper"))
+	rs.HandleFunc(MethodGet, "/files/:id", reply("lower"))
+	var cases = map[string]string{
+		"/Files/ABC": "upper:ABC",
+		"/files/abc": "lower:abc",
+		"/FILES/abc": "",
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != body {
+			t.Errorf("case sensitive GET %s: want %q, got %q", path, body, w.Body.String())
+		}
+	}
+
+	rs = NewRouter(WithRawPath())
+	rs.HandleFunc(MethodGet, "/files/:id", reply("file"))
+	rs.HandleFunc(MethodGet, "/files/:id/meta", reply("meta"))
+	rs.HandleFunc(MethodGet, "/a b/:id", reply("space"))
+	cases = map[string]string{
+		"/files/a%2Fb":      "file:a/b",
+		"/files/a%2Fb/meta": "meta:a/b",
+		"/FILES/a%20b":      "file:a b",
+		"/a%20b/1":          "space:1",
+	}
+	for path, body := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Body.String() != body {
+			t.Errorf("raw path GET %s: want %q, got %q", path, body, w.Body.String())
+		}
+	}
+}
+
+func TestRouterRedirect(t *testing.T) {
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusOK, "ok:"+req.PathParamDefault("f"))
+	}
+	var serve = func(rs Router, method, target string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	var rs = NewRouter(WithRedirectSlash(http.StatusPermanentRedirect), WithCleanPath(0))
+	rs.HandleFunc(MethodGet, "/a/b", h)
+	rs.HandleFunc(MethodGet, "/dir/", h)
+	rs.HandleFunc(MethodGet, "/static/*f", h)
+	var cases = []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{"/a/b", http.StatusOK, ""},
+		{"/a/b/", http.StatusPermanentRedirect, "/a/b"},
+		{"/a//b?x=1", http.StatusMovedPermanently, "/a/b?x=1"},
+		{"/a/./c/../b", http.StatusMovedPermanently, "/a/b"},
+		{"/dir", http.StatusPermanentRedirect, "/dir/"},
+		{"/dir/", http.StatusOK, ""},
+		{"/static/js/", http.StatusOK, ""},
+	}
+	for _, c := range cases {
+		var w = serve(rs, MethodGet, c.target)
+		if w.Code != c.code || w.Header().Get("Location") != c.location {
+			t.Errorf("GET %s: want %d %q, got %d %q", c.target, c.code, c.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	rs = NewRouter(WithStrictSlash())
+	rs.HandleFunc(MethodGet, "/a/b", h)
+	rs.HandleFunc(MethodGet, "/a/b/", h)
+	rs.HandleFunc(MethodGet, "/c/", h)
+	rs.HandleFunc(MethodGet, "/static/*f", h)
+	if w := serve(rs, MethodGet, "/c"); w.Code != http.StatusNotFound {
+		t.Errorf("strict GET /c: want 404, got %d", w.Code)
+	}
+	if w := serve(rs, MethodGet, "/a/b/"); w.Code != http.StatusOK {
+		t.Errorf("strict GET /a/b/: want 200, got %d", w.Code)
+	}
+	if w := serve(rs, MethodGet, "/static/js/"); w.Body.String() != "ok:js/" {
+		t.Errorf("strict GET /static/js/: want catch-all with slash, got %q", w.Body.String())
+	}
+
+	rs = NewRouter(WithStrictSlash(), WithRedirectSlash(0))
+	rs.HandleFunc(MethodGet, "/c/", h)
+	if w := serve(rs, MethodHead, "/c"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/c/" {
+		t.Errorf("strict redirect HEAD /c: got %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	var rs = NewRouter()
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}
+	rs.Group("/user", func(r Router) {
+		r.HandleFunc("GET,POST", "/{id:int}/orders/:order", h).Name("order")
+		r.HandleFunc(MethodGet, "/files/*path", h).Name("files")
+	})
+	rs.HandleFunc(MethodGet, "/a/*/b", h).Name("anonymous")
+
+	var cases = []struct {
+		name  string
+		pairs []string
+		want  string
+		err   bool
+	}{
+		{"order", []string{"id", "42", "order", "a b/c"}, "/user/42/orders/a%20b%2Fc", false},
+		{"order", []string{"order", "1", "id", "42", "tab", "x&y", "page", "2"}, "/user/42/orders/1?page=2&tab=x%26y", false},
+		{"order", []string{"id", "42"}, "", true},
+		{"order", []string{"id", "abc", "order", "1"}, "", true},
+		{"order", []string{"id"}, "", true},
+		{"files", []string{"path", "css/a b.css"}, "/user/files/css/a%20b.css", false},
+		{"anonymous", nil, "", true},
+		{"none", nil, "", true},
+	}
+	for _, c := range cases {
+		var u, err = rs.URL(c.name, c.pairs...)
+		if u != c.want || (err != nil) != c.err {
+			t.Errorf("URL(%s, %v): want %q err %v, got %q %v", c.name, c.pairs, c.want, c.err, u, err)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("want duplicated route name to panic")
+			}
+		}()
+		rs.HandleFunc(MethodGet, "/other", h).Name("order")
+	}()
+}
+
+func TestRouterRoutes(t *testing.T) {
+	var rs = NewRouter()
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}
+	var mw MiddlewareFunc = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(ctx, w, req)
+	}
+	rs.Use(mw)
+	rs.HandleFunc(MethodGet, "/", h).Name("index")
+	rs.Group("/api", func(r Router) {
+		r.HandleFunc("GET,POST", "/user/:id", h, mw).Name("user")
+	}, mw)
+
+	var got []string
+	_ = rs.Walk(func(route Route) error {
+		got = append(got, fmt.Sprintf("%s %s %s %d", route.Method(), route.Path(), route.Name(), route.Middlewares()))
+		return nil
+	})
+	var want = []string{
+		"GET / index 1",
+		"GET /api/user/:id user 3",
+		"POST /api/user/:id user 3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want routes %v, got %v", want, got)
+	}
+	if len(rs.Routes()) != len(want) {
+		t.Fatalf("want %d routes, got %d", len(want), len(rs.Routes()))
+	}
+
+	var stop = fmt.Errorf("stop")
+	var walked int
+	if err := rs.Walk(func(route Route) error {
+		walked++
+		return stop
+	}); err != stop || walked != 1 {
+		t.Fatalf("want walk to stop on error, got %v after %d", err, walked)
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	var sub = NewRouter()
+	sub.HandleFunc(MethodGet, "/users/:id", func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusOK, "sub:"+req.PathParamDefault("id")+":"+OriginalPath(ctx))
+	})
+	// the parent route and its mountpath param do not leak into the mounted router
+	sub.HandleFunc(MethodGet, "/info", func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusOK, "info:"+req.PathParamDefault("mountpath")+":"+RouteFromContext(ctx).Path())
+	})
+	var legacy http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		if RouteFromContext(r.Context()) != nil || len(ParamsFromContext(r.Context())) > 0 {
+			t.Errorf("want no route or params in the mounted handler, got %v", ParamsFromContext(r.Context()))
+		}
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + OriginalPath(r.Context())))
+	}
+
+	var rs = NewRouter()
+	var ran int
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		ran++
+		return next.Next(ctx, w, req)
+	})
+	rs.Mount("/legacy/", legacy)
+	rs.Group("/api", func(r Router) {
+		r.Mount("/v1", sub)
+	})
+	rs.HandleFunc(MethodGet, "/legacy/exact", func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusOK, "exact")
+	})
+
+	var cases = []struct {
+		method, target, body string
+	}{
+		{MethodGet, "/legacy", "GET / /legacy"},
+		{MethodPost, "/legacy/a/b/", "POST /a/b/ /legacy/a/b/"},
+		{MethodGet, "/legacy/exact", "exact"},
+		{MethodGet, "/api/v1/users/Tom", "sub:Tom:/api/v1/users/Tom"},
+		{MethodGet, "/api/v1/info", "info::/info"},
+	}
+	for _, c := range cases {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(c.method, c.target, nil))
+		if w.Body.String() != c.body {
+			t.Errorf("%s %s: want %q, got %q", c.method, c.target, c.body, w.Body.String())
+		}
+	}
+	if ran != len(cases) {
+		t.Fatalf("want parent middleware to run %d times, got %d", len(cases), ran)
+	}
+}
+
+func TestRouterHost(t *testing.T) {
+	var reply = func(name string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, name+":"+req.PathParamDefault("tenant")+":"+req.PathParamDefault("id"))
+		}
+	}
+	var rs = NewRouter()
+	rs.Host("{tenant}.example.com", func(r Router) {
+		r.HandleFunc(MethodGet, "/user/:id", reply("tenant"))
+	})
+	rs.Host("api.example.com", func(r Router) {
+		r.Group("/v1", func(r Router) {
+			r.HandleFunc(MethodGet, "/user/:id", reply("api"))
+		})
+	})
+	rs.Host("{tenant:alpha}.example.com", func(r Router) {
+		r.HandleFunc(MethodPost, "/user/:id", reply("alpha"))
+	})
+	rs.HandleFunc(MethodGet, "/user/:id", reply("default"))
+	rs.HandleFunc(MethodGet, "/v1/user/:id", reply("default-v1"))
+
+	var cases = []struct {
+		method, host, path, body string
+	}{
+		{MethodGet, "api.example.com:8080", "/v1/user/1", "api::1"},
+		{MethodGet, "API.example.com", "/user/2", "tenant:api:2"},
+		{MethodGet, "acme.example.com", "/user/3", "tenant:acme:3"},
+		{MethodPost, "acme.example.com", "/user/3", "alpha:acme:3"},
+		{MethodGet, "acme.example.com", "/v1/user/4", "default-v1::4"},
+		{MethodGet, "a.b.example.com", "/user/5", "default::5"},
+		{MethodGet, "other.com", "/user/6", "default::6"},
+	}
+	for _, c := range cases {
+		var w = httptest.NewRecorder()
+		var req = httptest.NewRequest(c.method, c.path, nil)
+		req.Host = c.host
+		rs.ServeHTTP(w, req)
+		if w.Body.String() != c.body {
+			t.Errorf("%s %s%s: want %q, got %q", c.method, c.host, c.path, c.body, w.Body.String())
+		}
+	}
+
+	var w = httptest.NewRecorder()
+	var req = httptest.NewRequest(MethodPost, "/user/1", nil)
+	req.Host = "1.example.com"
+	rs.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get(HeaderAllow) != "GET, HEAD, OPTIONS" {
+		t.Errorf("POST 1.example.com/user/1: want 405, got %d %q", w.Code, w.Header().Get(HeaderAllow))
+	}
+}
+
+func TestRouterMatcher(t *testing.T) {
+	var reply = func(name string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, name)
+		}
+	}
+	var rs = NewRouter()
+	rs.Match(AcceptMatcher("application/vnd.v2+json")).HandleFunc(MethodGet, "/user", reply("v2"))
+	rs.Match(AcceptMatcher("application/json")).HandleFunc(MethodGet, "/user", reply("v1"))
+	rs.Match(ContentTypeMatcher("multipart/form-data")).HandleFunc(MethodPost, "/upload", reply("multipart"))
+	rs.Match(ContentTypeMatcher("application/json")).HandleFunc(MethodPost, "/upload", reply("json"))
+	rs.Match(QueryMatcher("debug")).HandleFunc(MethodGet, "/status", reply("debug"))
+	rs.HandleFunc(MethodGet, "/status", reply("status"))
+	rs.Match(HeaderMatcher("X-Token", "")).Group("/admin", func(r Router) {
+		r.HandleFunc(MethodGet, "/", reply("admin"))
+	})
+
+	var cases = []struct {
+		method, path string
+		header       map[string]string
+		code         int
+		body         string
+	}{
+		{MethodGet, "/user", map[string]string{"Accept": "application/vnd.v2+json"}, http.StatusOK, "v2"},
+		{MethodGet, "/user", map[string]string{"Accept": "text/html, application/json;q=0.8"}, http.StatusOK, "v1"},
+		{MethodGet, "/user", nil, http.StatusOK, "v2"},
+		{MethodGet, "/user", map[string]string{"Accept": "text/html"}, http.StatusNotAcceptable, ""},
+		{MethodPost, "/upload", map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusOK, "json"},
+		{MethodPost, "/upload", map[string]string{"Content-Type": "multipart/form-data; boundary=x"}, http.StatusOK, "multipart"},
+		{MethodPost, "/upload", map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType, ""},
+		{MethodGet, "/status?debug=1", nil, http.StatusOK, "debug"},
+		{MethodGet, "/status", nil, http.StatusOK, "status"},
+		{MethodGet, "/admin", map[string]string{"X-Token": "1"}, http.StatusOK, "admin"},
+		{MethodGet, "/admin", nil, http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		var w = httptest.NewRecorder()
+		var req = httptest.NewRequest(c.method, c.path, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		rs.ServeHTTP(w, req)
+		if w.Code != c.code || w.Body.String() != c.body {
+			t.Errorf("%s %s %v: want %d %q, got %d %q", c.method, c.path, c.header, c.code, c.body, w.Code, w.Body.String())
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("want two routes without matchers to conflict")
+			}
+		}()
+		rs.HandleFunc(MethodGet, "/status", reply("again"))
+	}()
+}
+
+func TestRouterFallback(t *testing.T) {
+	var rs = NewRouter()
+	var reply = func(body string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, body)
+		}
+	}
+	rs.NotFound(reply("html 404"))
+	rs.HandleFunc(MethodGet, "/", reply("index"))
+	rs.Group("/api", func(r Router) {
+		r.NotFound(func(ctx context.Context, req Request) Response {
+			return JsonResponse(http.StatusNotFound, map[string]string{"title": "not found", "from": fallbackFrom(ctx)})
+		})
+		r.MethodNotAllowed(reply("api 405"))
+		r.HandleFunc(MethodPost, "/user", reply("user"))
+		r.Group("/v2", func(r Router) {
+			r.NotFound(reply("v2 404"))
+		})
+	}, func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(ctx, w, req.WithContext(context.WithValue(req.Context(), fallbackCtxKey, "api")))
+	})
+	rs.Host("admin.example.com", func(r Router) {
+		r.NotFound(reply("admin 404"))
+	})
+
+	var cases = []struct {
+		method, host, path, body string
+	}{
+		{MethodGet, "", "/none", "html 404"},
+		{MethodGet, "", "/apiary", "html 404"},
+		{MethodGet, "", "/API/none", `{"from":"api","title":"not found"}`},
+		{MethodGet, "", "/api/user", "api 405"},
+		{MethodGet, "", "/api/v2/x", "v2 404"},
+		{MethodGet, "admin.example.com", "/none", "admin 404"},
+		{MethodGet, "admin.example.com", "/api/none", `{"from":"api","title":"not found"}`},
+	}
+	for _, c := range cases {
+		var rec = httptest.NewRecorder()
+		var req = httptest.NewRequest(c.method, c.path, nil)
+		if c.host != "" {
+			req.Host = c.host
+		}
+		rs.ServeHTTP(rec, req)
+		if rec.Body.String() != c.body {
+			t.Errorf("%s %s%s: want %q, got %q", c.method, c.host, c.path, c.body, rec.Body.String())
+		}
+	}
+
+	// fallbacks set while serving and inside Update are published with the route table
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			rs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(MethodGet, "/none", nil))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		rs.NotFound(reply("html 404"))
+	}
+	<-done
+	_ = rs.Update(func(r Router) error {
+		r.NotFound(reply("updated 404"))
+		var rec = httptest.NewRecorder()
+		rs.ServeHTTP(rec, httptest.NewRequest(MethodGet, "/none", nil))
+		if rec.Body.String() != "html 404" {
+			t.Errorf("want fallback unchanged before commit, got %q", rec.Body.String())
+		}
+		return nil
+	})
+	var rec = httptest.NewRecorder()
+	rs.ServeHTTP(rec, httptest.NewRequest(MethodGet, "/none", nil))
+	if rec.Body.String() != "updated 404" {
+		t.Fatalf("want fallback set in Update after commit, got %q", rec.Body.String())
+	}
+
+	// groups with equal-length prefixes resolve the same way on every request
+	rs.Group("/:lang", func(r Router) { r.NotFound(reply("lang 404")) })
+	rs.Group("/docs", func(r Router) { r.NotFound(reply("docs 404")) })
+	rs.Host("{sub}.example.com", func(r Router) {
+		r.Group("/docs", func(r Router) { r.NotFound(reply("sub docs 404")) })
+	})
+	for i := 0; i < 20; i++ {
+		for path, body := range map[string]string{"/docs/x": "docs 404", "/en/x": "lang 404"} {
+			var rec = httptest.NewRecorder()
+			rs.ServeHTTP(rec, httptest.NewRequest(MethodGet, path, nil))
+			if rec.Body.String() != body {
+				t.Fatalf("%s: want %q, got %q", path, body, rec.Body.String())
+			}
+		}
+		var rec = httptest.NewRecorder()
+		var req = httptest.NewRequest(MethodGet, "/docs/x", nil)
+		req.Host = "www.example.com"
+		rs.ServeHTTP(rec, req)
+		if rec.Body.String() != "sub docs 404" {
+			t.Fatalf("want host group first, got %q", rec.Body.String())
+		}
+	}
+}
+
+func TestRouterHotSwap(t *testing.T) {
+	var rs = NewRouter()
+	var reply = func(body string) HandlerFunc {
+		return func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusOK, body)
+		}
+	}
+	var get = func(p string) (int, string) {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(MethodGet, p, nil))
+		return w.Code, w.Body.String()
+	}
+	rs.HandleFunc(MethodGet, "/user/:id", reply("user"))
+	var beta = rs.HandleFunc(MethodGet, "/user/beta", reply("beta")).Name("beta")
+
+	beta.Disable()
+	if _, body := get("/user/beta"); body != "user" {
+		t.Fatalf("disabled route must fall through, got %q", body)
+	}
+	beta.Enable()
+	if _, body := get("/user/beta"); body != "beta" {
+		t.Fatalf("enabled route must match, got %q", body)
+	}
+	beta.Remove()
+	if _, err := rs.URL("beta"); err == nil || len(rs.Routes()) != 1 {
+		t.Fatalf("removed route must drop its name, got %v %d", err, len(rs.Routes()))
+	}
+
+	var err = rs.Update(func(r Router) error {
+		r.HandleFunc(MethodGet, "/order", reply("order"))
+		return fmt.Errorf("abort")
+	})
+	if code, _ := get("/order"); err == nil || code != http.StatusNotFound {
+		t.Fatalf("failed update must be discarded, got %v %d", err, code)
+	}
+	var order RouteSetter
+	_ = rs.Update(func(r Router) error {
+		r.Group("/v1", func(r Router) {
+			order = r.HandleFunc("GET,POST", "/order", reply("order"))
+		})
+		return nil
+	})
+	if _, body := get("/v1/order"); body != "order" {
+		t.Fatalf("update must take effect, got %q", body)
+	}
+	order.Remove()
+	if code, _ := get("/v1/order"); code != http.StatusNotFound || len(rs.Routes()) != 1 {
+		t.Fatalf("setter from update must act on the live table, got %d %d", code, len(rs.Routes()))
+	}
+
+	_ = rs.Swap(func(r Router) error {
+		r.HandleFunc(MethodGet, "/v2/user/:id", reply("v2"))
+		return nil
+	})
+	if code, _ := get("/user/1"); code != http.StatusNotFound {
+		t.Fatalf("swap must replace old routes, got %d", code)
+	}
+	if !rs.Remove(MethodGet, "/v2/user/:id") || rs.Remove(MethodGet, "/v2/user/:id") {
+		t.Fatal("remove must report whether a route was removed")
+	}
+
+	// the outer router inside f must not deadlock, the draft is discarded instead
+	err = rs.Update(func(r Router) error {
+		r.HandleFunc(MethodGet, "/draft", reply("draft"))
+		rs.HandleFunc(MethodGet, "/outer", reply("outer"))
+		return nil
+	})
+	if code, _ := get("/draft"); !errors.Is(err, errTableChanged) || code != http.StatusNotFound {
+		t.Fatalf("want conflicting update discarded, got %v %d", err, code)
+	}
+	if _, body := get("/outer"); body != "outer" {
+		t.Fatalf("want outer registration kept, got %q", body)
+	}
+
+	// renaming replaces the published route with a copy, keeping registration order
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			for _, route := range rs.Routes() {
+				_ = route.Name()
+			}
+		}
+	}()
+	var outer = rs.HandleFunc(MethodGet, "/outer/:id", reply("outer"))
+	for i := 0; i < 100; i++ {
+		outer.Name(fmt.Sprintf("outer%d", i))
+	}
+	<-done
+	var names []string
+	for _, route := range rs.Routes() {
+		names = append(names, route.Path()+" "+route.Name())
+	}
+	if want := []string{"/outer ", "/outer/:id outer99"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("want %v, got %v", want, names)
+	}
+	if u, err := rs.URL("outer99", "id", "1"); err != nil || u != "/outer/1" {
+		t.Fatalf("want url by new name, got %q %v", u, err)
+	}
+	if _, err := rs.URL("outer98"); err == nil {
+		t.Fatal("want old name released after rename")
+	}
+	if !rs.Remove(MethodGet, "/outer/:id") || !rs.Remove(MethodGet, "/outer") {
+		t.Fatal("want renamed route removable")
+	}
+
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			var p = fmt.Sprintf("/hot/%d", i)
+			rs.HandleFunc(MethodGet, p, reply("hot"))
+			rs.Remove(MethodGet, p)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		get(fmt.Sprintf("/hot/%d", i))
+	}
+	<-done
+}
+
+func TestRouterRouteContext(t *testing.T) {
+	var rs = NewRouter()
+	var matched []string
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		var route = RouteFromContext(req.Context())
+		if route == nil {
+			matched = append(matched, "")
+			return next.Next(ctx, w, req)
+		}
+		matched = append(matched, route.Method()+" "+route.Path()+" "+route.Name())
+		if scope, _ := route.Meta("scope"); scope == "admin" {
+			w.WriteHeader(http.StatusForbidden)
+			return false
+		}
+		return next.Next(ctx, w, req)
+	})
+	rs.HandleFunc(MethodGet, "/user/:id", func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}).Name("user").Meta("scope", "user")
+	rs.HandleFunc(MethodDelete, "/user/:id", func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}).Meta("scope", "admin").Meta("audit", true)
+
+	var codes []int
+	for _, method := range []string{MethodGet, MethodDelete, MethodPost} {
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, httptest.NewRequest(method, "/user/1", nil))
+		codes = append(codes, w.Code)
+	}
+	var want = []string{"GET /user/:id user", "DELETE /user/:id ", ""}
+	if !reflect.DeepEqual(matched, want) || !reflect.DeepEqual(codes, []int{200, 403, 405}) {
+		t.Fatalf("want %q %v, got %q %v", want, []int{200, 403, 405}, matched, codes)
+	}
+	var meta = rs.Routes()[1].Metadata()
+	if !reflect.DeepEqual(meta, map[string]any{"scope": "admin", "audit": true}) {
+		t.Fatalf("unexpected metadata %v", meta)
+	}
+}
+
+func TestRouterTryHandle(t *testing.T) {
+	var rs = NewRouter()
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}
+
+	var _, err = rs.TryHandleFunc("GET,FOO,BAR", "/user", h)
+	if err == nil || len(err.(interface{ Unwrap() []error }).Unwrap()) != 2 || len(rs.Routes()) != 0 {
+		t.Fatalf("want both invalid methods reported and nothing registered, got %v", err)
+	}
+
+	if _, err = rs.TryHandleFunc(MethodPost, "/user", h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rs.TryHandleFunc("GET,POST", "/user", h); err == nil || len(rs.Routes()) != 1 {
+		t.Fatalf("want conflict error and no partial registration, got %v %d", err, len(rs.Routes()))
+	}
+
+	var cases = []struct {
+		a, b      string
+		ambiguous bool
+	}{
+		{"/a/*/c", "/a/b/*", true},
+		{"/a/:x/c", "/a/b/:y", true},
+		{"/:lang/about", "/static/*filepath", true},
+		{"/a/:x", "/a/b", false},
+		{"/a/b/c", "/a/*rest", false},
+		{"/a/:x/c", "/a/b/d", false},
+		{"/a/{x:int}/c", "/a/b/:y", false},
+		{"/a/{x:alpha}/c", "/a/b/:y", true},
+		{"/a/{x:int}", "/a/{y:alpha}", false},
+		{"/*rest", "/", false},
+		{"/A/:x/c", "/a/b/:y", true},
+		{"/a/:x/c/d", "/a/b/:y/d", true},
+		{"/ab/:x/c", "/a/b/:y", false},
+		{"/a/b*", "/a/:x/c", false},
+	}
+	for _, c := range cases {
+		var rs = NewRouter()
+		rs.HandleFunc(MethodGet, c.a, h)
+		if _, err := rs.TryHandleFunc(MethodGet, c.b, h); (err != nil) != c.ambiguous {
+			t.Errorf("%s vs %s: want ambiguous %v, got %v", c.a, c.b, c.ambiguous, err)
+		}
+		// other methods and routes with matchers are not checked
+		if _, err := rs.TryHandleFunc(MethodPost, c.b, h); err != nil {
+			t.Error(err)
+		}
+		if _, err := rs.Match(HeaderMatcher("X-Version", "2")).TryHandleFunc(MethodGet, c.b, h); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// duplicated names and conflicting Mount, Static and OpenAPI routes are reported instead of panicking
+	rs = NewRouter()
+	var a, _ = rs.TryHandleFunc(MethodGet, "/a", h)
+	var b, _ = rs.TryHandleFunc(MethodGet, "/b", h)
+	if err := a.TryName("page"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.TryName("page"); err == nil {
+		t.Fatal("want duplicated route name error")
+	}
+	if u, _ := rs.URL("page"); u != "/a" || b.TryName("other") != nil {
+		t.Fatalf("want the name kept on /a and /b still nameable, got %q", u)
+	}
+	rs.HandleFunc(MethodGet, "/docs/*rest", h)
+	if _, err := rs.TryMount("/docs", http.NotFoundHandler()); err == nil {
+		t.Fatal("want mount conflict error")
+	}
+	if _, err := rs.TryStatic("/docs", fstest.MapFS{}); err == nil {
+		t.Fatal("want static conflict error")
+	}
+	if _, err := rs.TryOpenAPI("/a", OpenAPIInfo{}); err == nil {
+		t.Fatal("want openapi conflict error")
+	}
+	if _, err := rs.TryMount("/legacy", http.NotFoundHandler()); err != nil {
+		t.Fatal(err)
+	}
+
+	// HandleFunc does not check ambiguity, TryHandleFunc checks against routes registered by both
+	rs = NewRouter()
+	for _, p := range []string{"/:lang/about", "/static/*filepath", "/:x/user", "/user/:x", "/users/list", "/user/:x/orders"} {
+		rs.HandleFunc(MethodGet, p, h)
+	}
+	for p, ambiguous := range map[string]bool{"/:x/list/orders": true, "/user/:x/:y": false, "/:x/list": true, "/:x/about": true, "/docs/about": false, "/user/list/*rest": true} {
+		if _, err := rs.TryHandleFunc(MethodGet, p, h); (err != nil) != ambiguous {
+			t.Errorf("%s: want ambiguous %v, got %v", p, ambiguous, err)
+		}
+	}
+}
+
+func TestRouterOpenAPI(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type User struct {
+		ID      int64             `json:"id,string"`
+		Name    string            `json:"name"`
+		Email   string            `json:"email,omitempty"`
+		Tags    []string          `json:"tags"`
+		Address *Address          `json:"address"`
+		Extra   map[string]string `json:"-"`
+	}
+	var rs = NewRouter()
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return NopResponse(http.StatusOK)
+	}
+	rs.Group("/user", func(r Router) {
+		r.HandleFunc(MethodGet, "/{id:int}", h).Name("getUser").Operation(Operation{
+			Summary:   "get user",
+			Tags:      []string{"user"},
+			Response:  User{},
+			Responses: map[int]any{http.StatusNotFound: nil},
+		})
+		r.HandleFunc("PUT,PATCH", "/:id", h).Name("saveUser").Operation(Operation{Request: (*User)(nil), Response: []User{}})
+		r.HandleFunc(MethodGet, "/internal", h).Operation(Operation{Hidden: true})
+		r.Static("/assets", fstest.MapFS{})
+		r.Mount("/legacy", http.NotFoundHandler())
+	})
+	rs.HandleFunc(MethodAny, "/static/*filepath", h)
+	rs.HandleFunc(MethodGet, "/order/:id", h).Disable()
+	rs.Host("api.example.com", func(r Router) {
+		r.HandleFunc(MethodGet, "/avatar", h).Operation(Operation{OperationID: "apiAvatar"})
+		r.HandleFunc(MethodGet, "/host", h).Operation(Operation{OperationID: "host"})
+	})
+	rs.HandleFunc("GET,POST", "/avatar", h).Operation(Operation{OperationID: "avatar", Summary: "a: b # c \"q\"\nline"})
+	rs.OpenAPI("/openapi.json", OpenAPIInfo{Title: "seed", Version: "1.0"})
+	rs.OpenAPI("/openapi.yaml", OpenAPIInfo{Title: "seed", Version: "1.0"})
+
+	var w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(MethodGet, "/openapi.json", nil))
+	var doc OpenAPI
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for p, item := range doc.Paths {
+		for method := range item {
+			paths = append(paths, method+" "+p)
+		}
+	}
+	sort.Strings(paths)
+	var want = []string{
+		"delete /static/{filepath}", "get /avatar", "get /host", "get /static/{filepath}", "get /user/{id}",
+		"patch /static/{filepath}", "patch /user/{id}",
+		"post /avatar", "post /static/{filepath}", "put /static/{filepath}", "put /user/{id}",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("want paths %v, got %v", want, paths)
+	}
+
+	var get = doc.Paths["/user/{id}"]["get"]
+	if get.OperationID != "getUser" || get.Parameters[0].Schema.Type != "integer" || get.Responses["404"] == nil ||
+		get.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/User" {
+		t.Fatalf("unexpected get operation %+v", get)
+	}
+	if doc.Paths["/user/{id}"]["patch"].OperationID != "saveUser_patch" {
+		t.Fatalf("want deduplicated operation id, got %q", doc.Paths["/user/{id}"]["patch"].OperationID)
+	}
+	var avatar = []string{doc.Paths["/avatar"]["get"].OperationID, doc.Paths["/avatar"]["post"].OperationID}
+	sort.Strings(avatar)
+	if !reflect.DeepEqual(avatar, []string{"avatar", "avatar_post"}) && !reflect.DeepEqual(avatar, []string{"avatar", "avatar_get"}) {
+		t.Fatalf("want unique explicit operation ids, got %v", avatar)
+	}
+	if doc.Paths["/avatar"]["get"].Host != "" || doc.Paths["/host"]["get"].Host != "api.example.com" {
+		t.Fatalf("want routes without host first and x-host for host routes, got %+v %+v", doc.Paths["/avatar"]["get"], doc.Paths["/host"]["get"])
+	}
+	var user = doc.Components.Schemas["User"]
+	if user.Properties["id"].Type != "string" || user.Properties["address"].Ref != "#/components/schemas/Address" ||
+		user.Properties["Extra"] != nil || !reflect.DeepEqual(user.Required, []string{"id", "name", "tags"}) {
+		t.Fatalf("unexpected user schema %+v", user)
+	}
+
+	w = httptest.NewRecorder()
+	rs.ServeHTTP(w, httptest.NewRequest(MethodGet, "/openapi.yaml", nil))
+	var body = w.Body.String()
+	for _, line := range []string{
+		`openapi: "3.1.0"` + "\n",
+		"  /user/{id}:\n    get:\n      operationId: getUser\n",
+		"      parameters:\n        - name: id\n          in: path\n          required: true\n",
+		`              $ref: "#/components/schemas/User"` + "\n",
+		"      tags:\n        - user\n",
+		`      summary: "a: b # c \"q\"\nline"` + "\n",
+		`      x-host: api.example.com` + "\n",
+		`        "404":` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("yaml missing %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestOpenAPIYAMLString(t *testing.T) {
+	for s, want := range map[string]string{
+		"getUser":     "getUser",
+		"/user/{id}":  "/user/{id}",
+		"":            `""`,
+		"a: b":        `"a: b"`,
+		"a:b":         `"a:b"`,
+		"# comment":   `"# comment"`,
+		"a #b":        `"a #b"`,
+		`say "hi"`:    `"say \"hi\""`,
+		"it's":        `"it's"`,
+		"line\nbreak": `"line\nbreak"`,
+		"- item":      `"- item"`,
+		" padded":     `" padded"`,
+		"1.0":         `"1.0"`,
+		"200":         `"200"`,
+		"No":          `"No"`,
+		"null":        `"null"`,
+	} {
+		if got := yamlString(s); got != want {
+			t.Errorf("%q: want %s, got %s", s, want, got)
+		}
+	}
+}
+
+func TestRouterStatic(t *testing.T) {
+	var fsys = fstest.MapFS{
+		"index.html":        {Data: []byte("<app>")},
+		"app.js":            {Data: []byte("console.log('seed')"), ModTime: time.Unix(1700000000, 0)},
+		"app.js.gz":         {Data: []byte("gzipped"), ModTime: time.Unix(1700000000, 0)},
+		"docs/readme.txt":   {Data: []byte("0123456789")},
+		"assets/logo.svg":   {Data: []byte("<svg/>")},
+		"assets/index.html": {Data: []byte("assets")},
+	}
+	var served int
+	var rs = NewRouter()
+	rs.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		served++
+		return next.Next(ctx, w, req)
+	})
+	rs.Static("/static", fsys, WithCacheControl(func(name string) string {
+		if strings.HasSuffix(name, ".js") || strings.HasSuffix(name, ".js.gz") {
+			return "public, max-age=31536000, immutable"
+		}
+		return ""
+	}))
+	rs.Static("/files/", fsys, WithDirListing())
+	rs.Static("/", fsys, WithSPAFallback("index.html"))
+	rs.NotFound(func(ctx context.Context, req Request) Response {
+		return HtmlResponse(http.StatusNotFound, "root 404")
+	})
+	rs.Group("/static", func(r Router) {
+		r.NotFound(func(ctx context.Context, req Request) Response {
+			return HtmlResponse(http.StatusNotFound, "static 404")
+		})
+	})
+
+	var do = func(p string, header ...string) *httptest.ResponseRecorder {
+		var req = httptest.NewRequest(MethodGet, p, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		var w = httptest.NewRecorder()
+		rs.ServeHTTP(w, req)
+		return w
+	}
+
+	var w = do("/static/docs/readme.txt")
+	var etag = w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" || etag == "" || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("unexpected file response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if w = do("/static/docs/readme.txt", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("want 304 for matching etag, got %d", w.Code)
+	}
+	if w = do("/static/docs/readme.txt", "Range", "bytes=2-4"); w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Fatalf("want 206 with range body, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = do("/static/app.js", "Accept-Encoding", "br, gzip")
+	if w.Body.String() != "gzipped" || w.Header().Get("Content-Encoding") != "gzip" ||
+		!strings.HasPrefix(w.Header().Get(HeaderContentType), "text/javascript") ||
+		w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("want precompressed js, got %q %v", w.Body.String(), w.Header())
+	}
+	if w = do("/static/app.js", "Accept-Encoding", "gzip;q=0"); w.Body.String() != "console.log('seed')" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("want plain js, got %q %v", w.Body.String(), w.Header())
+	}
+
+	if w = do("/static/assets"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/static/assets/" {
+		t.Fatalf("want redirect to directory, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w = do("/static/assets/"); w.Body.String() != "assets" {
+		t.Fatalf("want directory index, got %q", w.Body.String())
+	}
+	if w = do("/static/docs/"); w.Body.String() != "static 404" {
+		t.Fatalf("want group 404 without listing, got %d %q", w.Code, w.Body.String())
+	}
+	if w = do("/files/docs/"); !strings.Contains(w.Body.String(), `<a href="readme.txt">readme.txt</a>`) {
+		t.Fatalf("want directory listing, got %q", w.Body.String())
+	}
+	if w = do("/static/../app.js"); w.Code != http.StatusOK {
+		t.Fatalf("want cleaned path to stay inside fs, got %d", w.Code)
+	}
+
+	if w = do("/settings/profile"); w.Body.String() != "<app>" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("want spa index, got %q %v", w.Body.String(), w.Header())
+	}
+	if w = do("/missing.js"); w.Body.String() != "root 404" {
+		t.Fatalf("want router 404 for missing asset, got %d %q", w.Code, w.Body.String())
+	}
+	if served != 12 {
+		t.Fatalf("want middleware for every request, got %d", served)
+	}
+}
+
+func TestRouterBuiltinHandlers(t *testing.T) {
+	var noop MiddlewareFunc = func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		return next.Next(ctx, w, req)
+	}
+	var h HandlerFunc = func(ctx context.Context, req Request) Response {
+		return nil
+	}
+	var allocs = func(rs Router, method, path string) float64 {
+		var w = httptest.NewRecorder()
+		var req = httptest.NewRequest(method, path, nil)
+		return testing.AllocsPerRun(50, func() { rs.ServeHTTP(w, req) })
+	}
+	var plain, wrapped = NewRouter(WithCleanPath(0)), NewRouter(WithCleanPath(0))
+	wrapped.Use(noop, noop, noop, noop, noop, noop)
+	for _, rs := range []Router{plain, wrapped} {
+		rs.HandleFunc(MethodPost, "/user", h)
+		rs.Match(ContentTypeMatcher("application/json")).HandleFunc(MethodPut, "/user", h)
+	}
+	var cases = []struct{ method, path string }{
+		{MethodGet, "/missing"},
+		{MethodGet, "/user"},
+		{MethodOptions, "/user"},
+		{MethodGet, "/a/../user"},
+		{MethodPut, "/user"},
+	}
+	for _, c := range cases {
+		// the middleware chain is built once, so its length must not add allocations per request
+		if a, b := allocs(plain, c.method, c.path), allocs(wrapped, c.method, c.path); a != b {
+			t.Errorf("%s %s: want equal allocs with and without middlewares, got %v and %v", c.method, c.path, a, b)
+		}
+	}
+
+	var used = 0
+	plain.Use(func(ctx context.Context, w http.ResponseWriter, req *http.Request, next MiddleWareQueue) bool {
+		used++
+		return next.Next(ctx, w, req)
+	})
+	var w = httptest.NewRecorder()
+	plain.ServeHTTP(w, httptest.NewRequest(MethodGet, "/missing", nil))
+	if used != 1 || w.Code != http.StatusNotFound {
+		t.Fatalf("want middleware added by Use after serving, got %d %d", used, w.Code)
+	}
+}
+
+var fallbackCtxKey = &ContextKey{Name: "fallback"}
+
+func fallbackFrom(ctx context.Context) string {
+	v, _ := ctx.Value(fallbackCtxKey).(string)
+	return v
 }
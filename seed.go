@@ -57,9 +57,11 @@ type mseed struct {
 }
 
 // New return *mseed
-func New() MSeed {
+//
+//	opts 是路由器的配置项，详见 NewRouter
+func New(opts ...RouterOption) MSeed {
 	return &mseed{
-		Router: NewRouter(),
+		Router: NewRouter(opts...),
 		server: &http.Server{},
 	}
 }
@@ -0,0 +1,306 @@
+package seed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// staticPathParam 静态文件路由末尾通配段的参数名
+const staticPathParam = "filepath"
+
+// staticIndex 目录的默认首页
+const staticIndex = "index.html"
+
+// StaticOption 静态文件配置项，在 Router.Static 时传入
+type StaticOption func(o *staticOptions)
+
+// staticOptions 静态文件配置
+type staticOptions struct {
+	// listing 没有首页的目录输出文件列表，默认响应 404
+	listing bool
+
+	// cacheControl 返回文件的 Cache-Control，返回空值时不设置
+	cacheControl func(name string) string
+
+	// spaIndex 非空时，不存在且没有扩展名的路径响应该文件
+	spaIndex string
+}
+
+// WithDirListing 没有 index.html 的目录输出文件列表
+func WithDirListing() StaticOption {
+	return func(o *staticOptions) {
+		o.listing = true
+	}
+}
+
+// WithCacheControl 按文件设置 Cache-Control
+//
+//	policy 的参数是文件在 fs.FS 中的路径，返回空值时不设置
+//	如带 hash 的资源文件可以返回 "public, max-age=31536000, immutable"
+func WithCacheControl(policy func(name string) string) StaticOption {
+	return func(o *staticOptions) {
+		o.cacheControl = policy
+	}
+}
+
+// WithSPAFallback 不存在的路径响应单页应用的首页
+//
+//	index 是首页在 fs.FS 中的路径，如 "index.html"
+//	只对没有扩展名的路径生效，不存在的 /app.js 仍然响应 404
+//	未设置 WithCacheControl 时首页的 Cache-Control 为 no-cache
+func WithSPAFallback(index string) StaticOption {
+	return func(o *staticOptions) {
+		o.spaIndex = index
+	}
+}
+
+// Static 实现 Router
+func (r *router) Static(prefix string, fsys fs.FS, opts ...StaticOption) RouteSetter {
+	return mustRegister(r.static(prefix, fsys, false, opts...))
+}
+
+// TryStatic 实现 Router
+func (r *router) TryStatic(prefix string, fsys fs.FS, opts ...StaticOption) (RouteSetter, error) {
+	return r.static(prefix, fsys, true, opts...)
+}
+
+// static 注册静态文件路由，checkAmbiguous 为 true 时检查有歧义的路由
+func (r *router) static(prefix string, fsys fs.FS, checkAmbiguous bool, opts ...StaticOption) (RouteSetter, error) {
+	var s = &staticHandler{router: r, fsys: fsys}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	var rs, err = r.handle(MethodGet, strings.TrimSuffix(prefix, "/")+"/*"+staticPathParam, s, checkAmbiguous)
+	if err != nil {
+		return nil, err
+	}
+	return rs.Operation(Operation{Hidden: true}), nil
+}
+
+// staticHandler 输出 fs.FS 中的文件
+type staticHandler struct {
+	router  *router
+	fsys    fs.FS
+	options staticOptions
+
+	// etags 没有修改时间的文件(如 embed.FS)按内容计算的 ETag
+	etags sync.Map
+}
+
+// ServeHTTP 实现 http.Handler
+func (s *staticHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var p, _ = ParamsFromContext(req.Context()).Get(staticPathParam)
+	var name = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+
+	var f, info, err = s.open(name)
+	if errors.Is(err, fs.ErrNotExist) && s.options.spaIndex != "" && path.Ext(name) == "" {
+		name = s.options.spaIndex
+		f, info, err = s.open(name)
+	}
+	if err != nil {
+		s.error(w, req, err)
+		return
+	}
+	defer f.Close()
+
+	if info.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			var u = url.URL{Path: path.Base(req.URL.Path) + "/", RawQuery: req.URL.RawQuery}
+			http.Redirect(w, req, u.String(), http.StatusMovedPermanently)
+			return
+		}
+		var index, indexInfo, err = s.open(path.Join(name, staticIndex))
+		if err == nil && !indexInfo.IsDir() {
+			defer index.Close()
+			s.serveFile(w, req, path.Join(name, staticIndex), index, indexInfo)
+			return
+		}
+		if !s.options.listing {
+			s.error(w, req, fs.ErrNotExist)
+			return
+		}
+		s.serveDir(w, req, name)
+		return
+	}
+	s.serveFile(w, req, name, f, info)
+}
+
+// open 打开文件并返回文件信息
+func (s *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	var f, err = s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var info fs.FileInfo
+	if info, err = f.Stat(); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// serveFile 输出文件，支持 ETag、Last-Modified 及 Range
+//
+// 请求接受 gzip 且存在 name.gz 时输出压缩后的文件
+func (s *staticHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, f fs.File, info fs.FileInfo) {
+	var header = w.Header()
+	var contentType = mime.TypeByExtension(path.Ext(name))
+	if gz, gzInfo, err := s.open(name + ".gz"); err == nil {
+		defer gz.Close()
+		header.Add("Vary", "Accept-Encoding")
+		if !gzInfo.IsDir() && acceptsGzip(req) {
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			header.Set("Content-Encoding", "gzip")
+			name, f, info = name+".gz", gz, gzInfo
+		}
+	}
+	if contentType != "" {
+		header.Set(HeaderContentType, contentType)
+	}
+
+	var content, err = s.seeker(f)
+	if err != nil {
+		s.error(w, req, err)
+		return
+	}
+	var etag string
+	if etag, err = s.etag(name, info, content); err != nil {
+		s.error(w, req, err)
+		return
+	}
+	header.Set("ETag", etag)
+
+	var cacheControl = ""
+	if s.options.cacheControl != nil {
+		cacheControl = s.options.cacheControl(name)
+	} else if name == s.options.spaIndex {
+		cacheControl = "no-cache"
+	}
+	if cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	http.ServeContent(w, req, name, info.ModTime(), content)
+}
+
+// seeker 返回可以 Seek 的文件内容，文件不支持 Seek 时读取到内存中
+func (s *staticHandler) seeker(f fs.File) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	var bs, err = io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(bs), nil
+}
+
+// etag 返回文件的 ETag
+//
+// 有修改时间时由大小及修改时间生成，否则按内容计算并缓存
+func (s *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+	if etag, ok := s.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	var h = sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	var etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(name, etag)
+	return etag, nil
+}
+
+// serveDir 输出目录中的文件列表
+func (s *staticHandler) serveDir(w http.ResponseWriter, req *http.Request, name string) {
+	var entries, err = fs.ReadDir(s.fsys, name)
+	if err != nil {
+		s.error(w, req, err)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		var entryName = entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		var u = url.URL{Path: entryName}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(entryName))
+	}
+	buf.WriteString("</pre>\n")
+
+	w.Header().Set(HeaderContentType, "text/html; charset=utf-8")
+	w.Header().Set(HeaderContentLength, strconv.Itoa(buf.Len()))
+	if req.Method != MethodHead {
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// error 按错误类型响应 404、403 或 500
+func (s *staticHandler) error(w http.ResponseWriter, req *http.Request, err error) {
+	var code = http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		code = http.StatusForbidden
+	}
+	if code == http.StatusNotFound {
+		s.notFound(w, req)
+		return
+	}
+	w.WriteHeader(code)
+}
+
+// notFound 使用请求所在分组的 NotFound 处理器响应 404，请求已经过路由的中间件，不再重复执行
+func (s *staticHandler) notFound(w http.ResponseWriter, req *http.Request) {
+	var r = s.router
+	var h = r.fallbackHandler(r.tables.load(), req, r.options.requestPath(req), func(fb *fallback) http.Handler { return fb.rawNotFound })
+	if h == nil {
+		h = globalHandler(&NotFoundHandler)
+	}
+	h.ServeHTTP(w, req)
+}
+
+// acceptsGzip 判断请求是否接受 gzip 编码
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range req.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			var coding, params, _ = strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			var q, hasQ = strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !hasQ {
+				return true
+			}
+			var weight, err = strconv.ParseFloat(q, 64)
+			return err == nil && weight > 0
+		}
+	}
+	return false
+}
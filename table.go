@@ -0,0 +1,226 @@
+package seed
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// errNotChanged 修改路由表时没有实际修改，不需要替换路由表
+var errNotChanged = errors.New("route table not changed")
+
+// errTableChanged Update、Swap 执行 f 期间路由表被其他修改替换
+var errTableChanged = errors.New("route table changed during Update or Swap, use the router passed to f inside f")
+
+// routeTable 某一版本的路由表，生效后不再修改
+type routeTable struct {
+	mapper    RouteMapper
+	names     routeNames
+	fallbacks []*fallback
+}
+
+// routeNames 按名称索引的路由
+//
+// 复用路由树的压缩前缀树节点，修改时只复制路径上的节点，与路由表的其他版本互不影响
+type routeNames struct {
+	root *radixNode
+}
+
+// routeReplacer 可以原地替换路由的 RouteMapper，替换后路由的注册顺序不变
+type routeReplacer interface {
+	replace(old, new Route) bool
+}
+
+// routeTables 当前生效的路由表
+//
+// 修改路由时先复制出新版本的路由表，修改完成后原子替换(copy-on-write)
+// 请求始终使用某一个完整版本的路由表，修改与请求可以并发进行
+type routeTables struct {
+	mu      sync.Mutex
+	current atomic.Pointer[routeTable]
+
+	// target Update、Swap 提交后，草稿上的读写都转到 target
+	target atomic.Pointer[routeTables]
+}
+
+// newRouteTable 返回空的路由表
+func newRouteTable(options routerOptions) *routeTable {
+	return &routeTable{mapper: newRadixMapper(options)}
+}
+
+// newRouteTables 返回以 t 为当前版本的 routeTables
+func newRouteTables(t *routeTable) *routeTables {
+	var ts = &routeTables{}
+	ts.current.Store(t)
+	return ts
+}
+
+// clone 复制路由表，names 及 fallbacks 在修改时才复制
+func (t *routeTable) clone() *routeTable {
+	return &routeTable{mapper: t.mapper.Clone(), names: t.names, fallbacks: t.fallbacks}
+}
+
+// rename 使用改名后的副本 renamed 替换路由 r，r 原有的名称不再指向 r
+//
+// 已发布的路由可能正在被请求读取，修改属性时需要替换为副本
+func (t *routeTable) rename(r, renamed *route) bool {
+	var replaced bool
+	if rr, ok := t.mapper.(routeReplacer); ok {
+		replaced = rr.replace(r, renamed)
+	} else {
+		replaced = t.mapper.Remove(r) && t.mapper.Add(renamed) == nil
+	}
+	if named, _ := t.names.get(r.name); r.name != "" && named == r {
+		t.names.set(r.name, nil)
+	}
+	return replaced
+}
+
+// remove 删除路由，路由的名称不再被其他路由使用时一起删除
+func (t *routeTable) remove(r *route) bool {
+	if !t.mapper.Remove(r) {
+		return false
+	}
+	if named, _ := t.names.get(r.name); r.name == "" || named != r {
+		return true
+	}
+	t.names.set(r.name, nil)
+	for _, other := range t.mapper.Routes() {
+		if named, ok := other.(*route); ok && named.name == r.name {
+			t.names.set(r.name, named)
+			break
+		}
+	}
+	return true
+}
+
+// get 按名称查找路由
+func (ns routeNames) get(name string) (*route, bool) {
+	var n = ns.root
+	for s := name; n != nil && s != ""; {
+		var child = n.staticChild(s[0])
+		if child == nil || !strings.HasPrefix(s, child.prefix) {
+			return nil, false
+		}
+		n, s = child, s[len(child.prefix):]
+	}
+	if n == nil || len(n.leaves) == 0 {
+		return nil, false
+	}
+	return n.leaves[0].route.(*route), true
+}
+
+// set 设置名称对应的路由，r 为 nil 时删除，只复制从根节点到该名称路径上的节点
+func (ns *routeNames) set(name string, r *route) {
+	var root = ns.root.clone()
+	var n = root.staticChildPath(name, r != nil)
+	if n == nil {
+		return
+	}
+	n.leaves = nil
+	if r != nil {
+		n.leaves = routeLeaves{{route: r}}
+	}
+	ns.root = root
+}
+
+// resolve 返回提交后转到的 routeTables
+func (ts *routeTables) resolve() *routeTables {
+	for target := ts.target.Load(); target != nil; target = ts.target.Load() {
+		ts = target
+	}
+	return ts
+}
+
+// load 返回当前生效的路由表
+func (ts *routeTables) load() *routeTable {
+	return ts.resolve().current.Load()
+}
+
+// update 在当前路由表的副本上执行 f，f 成功后替换当前路由表
+//
+// f 返回 errNotChanged 时不替换，update 返回 nil
+func (ts *routeTables) update(f func(t *routeTable) error) error {
+	ts = ts.resolve()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var t = ts.current.Load().clone()
+	if err := f(t); err != nil {
+		if errors.Is(err, errNotChanged) {
+			return nil
+		}
+		return err
+	}
+	ts.current.Store(t)
+	return nil
+}
+
+// commit 使用 draft 上修改后的路由表替换当前路由表，此后 draft 上的读写都转到 ts
+func (ts *routeTables) commit(draft *routeTables) {
+	ts.current.Store(draft.current.Load())
+	draft.target.Store(ts)
+}
+
+// Update 实现 Router
+func (r *router) Update(f func(r Router) error) error {
+	var ts = r.tables.resolve()
+	var base = ts.current.Load()
+	return r.draft(ts, base, base.clone(), f)
+}
+
+// Swap 实现 Router
+func (r *router) Swap(f func(r Router) error) error {
+	var ts = r.tables.resolve()
+	var base = ts.current.Load()
+	var t = newRouteTable(r.options)
+	t.fallbacks = base.fallbacks
+	return r.draft(ts, base, t, f)
+}
+
+// draft 在以 base 为基础的草稿路由表 t 上执行 f，成功后提交到 ts
+//
+// 执行 f 时不持有锁，草稿的修改只作用于草稿本身；提交时当前路由表已不是 base 则放弃提交
+func (r *router) draft(ts *routeTables, base *routeTable, t *routeTable, f func(r Router) error) error {
+	var draft = r.fork()
+	draft.tables = newRouteTables(t)
+	if err := f(draft); err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.current.Load() != base {
+		return errTableChanged
+	}
+	ts.commit(draft.tables)
+	return nil
+}
+
+// Remove 实现 Router
+func (r *router) Remove(methods string, path string) bool {
+	var sepMethods, err = parseMethods(methods, path)
+	if err != nil {
+		return false
+	}
+	var removed = false
+	_ = r.tables.update(func(t *routeTable) error {
+		for _, rt := range t.mapper.Routes() {
+			var target, ok = rt.(*route)
+			if !ok || target.path != r.prefix+path || target.host != r.host {
+				continue
+			}
+			for _, method := range sepMethods {
+				if target.method == method && t.remove(target) {
+					removed = true
+				}
+			}
+		}
+		if !removed {
+			return errNotChanged
+		}
+		return nil
+	})
+	return removed
+}
@@ -0,0 +1,74 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URL 实现 Router
+func (r *router) URL(name string, pairs ...string) (string, error) {
+	var route, has = r.tables.load().names.get(name)
+	if !has {
+		return "", fmt.Errorf("route name: %s not found", name)
+	}
+	return buildURL(route.path, pairs...)
+}
+
+// buildURL 使用参数填充路由 pattern，多余的参数作为查询参数
+func buildURL(pattern string, pairs ...string) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("url params must be key value pairs")
+	}
+	var values = make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+
+	var used = make(map[string]bool, len(values))
+	var segments = strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if name, isCatchAll := catchAllName(segment); isCatchAll {
+			var v, has = values[name]
+			if !has {
+				return "", fmt.Errorf("missing url param: %s pattern: %s", name, pattern)
+			}
+			var parts = strings.Split(v, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i], used[name] = strings.Join(parts, "/"), true
+			continue
+		}
+		var name, constraint, isParam = paramName(segment)
+		if !isParam {
+			continue
+		}
+		if name == "" {
+			return "", fmt.Errorf("anonymous url param can not be built pattern: %s", pattern)
+		}
+		var v, has = values[name]
+		if !has {
+			return "", fmt.Errorf("missing url param: %s pattern: %s", name, pattern)
+		}
+		if constraint != "" {
+			if exp, err := compileConstraint(constraint); err == nil && !exp.MatchString(v) {
+				return "", fmt.Errorf("url param: %s value: %s does not match constraint: %s", name, v, constraint)
+			}
+		}
+		segments[i], used[name] = url.PathEscape(v), true
+	}
+
+	var u = strings.Join(segments, "/")
+	var query = url.Values{}
+	for k, v := range values {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}